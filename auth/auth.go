@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+const JWT = "jwt"
+
+var (
+	ErrNoToken         = errors.New("no token")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrSubjectMismatch = errors.New("subject of the token doesn't match the client certificate")
+)
+
+type Authenticator interface {
+	Authenticate(token string) (Claims, error)
+}
+
+func New(config config.Auth) (Authenticator, error) {
+	var authenticator Authenticator
+	var err error
+
+	switch config.Type {
+	case JWT:
+		authenticator, err = newJWTAuthenticator(config.JWT)
+	default:
+		err = fmt.Errorf("unknown auth type: %s", config.Type)
+	}
+
+	return authenticator, err
+}
+
+// Claims is a set of claims of an authenticated token.
+type Claims map[string]interface{}
+
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Strings returns the claim as a string slice. A single string claim is treated as a slice with one element.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+// CertificateSubjectClaim is the claim for the subject of the verified client certificate.
+const CertificateSubjectClaim = "cert_sub"
+
+func (c Claims) CertificateSubject() string {
+	s, _ := c[CertificateSubjectClaim].(string)
+	return s
+}
+
+// WithCertificate returns the claims of the token which the claims of the verified client certificate override,
+// so that the token can't impersonate the certificate. certificate is nil without a verified client certificate.
+func WithCertificate(token, certificate Claims) (Claims, error) {
+	if sub := token.Subject(); sub != "" && certificate != nil && sub != certificate.Subject() {
+		return nil, ErrSubjectMismatch
+	}
+	merged := make(Claims, len(token)+len(certificate))
+	for k, v := range token {
+		// NOTE: only the verified client certificate can set its subject
+		if k == CertificateSubjectClaim {
+			continue
+		}
+		merged[k] = v
+	}
+	for k, v := range certificate {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// FromTLS returns claims of the verified client certificate. The common name is used as "sub".
+// It returns nil if the client certificate isn't verified.
+func FromTLS(state *tls.ConnectionState) Claims {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+	return Claims{
+		"sub":                   cert.Subject.CommonName,
+		CertificateSubjectClaim: cert.Subject.String(),
+	}
+}
+
+type claimsKey struct{}
+
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+const bearerPrefix = "bearer "
+
+func bearerToken(authorization string) string {
+	if len(authorization) < len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(bearerPrefix):])
+}
+
+// TokenFromHeader extracts a token only from the Authorization header.
+func TokenFromHeader(r *http.Request) (string, error) {
+	if token := bearerToken(r.Header.Get("Authorization")); token != "" {
+		return token, nil
+	}
+	return "", ErrNoToken
+}
+
+// TokenFromRequest extracts a token from the Authorization header, or from the query
+// because EventSource can't set any request headers. An empty query disables the query.
+func TokenFromRequest(r *http.Request, query string) (string, error) {
+	if token, err := TokenFromHeader(r); err == nil {
+		return token, nil
+	}
+	if query == "" {
+		return "", ErrNoToken
+	}
+	if token := r.URL.Query().Get(query); token != "" {
+		return token, nil
+	}
+	return "", ErrNoToken
+}
+
+// TokenFromContext extracts a token from the authorization metadata of gRPC.
+func TokenFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ErrNoToken
+	}
+	for _, v := range md["authorization"] {
+		if token := bearerToken(v); token != "" {
+			return token, nil
+		}
+	}
+	return "", ErrNoToken
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenFromRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := http.NewRequest("GET", "/?eventType=program&token=query-token", nil)
+	assert.NoError(err)
+	token, err := TokenFromRequest(r, "token")
+	assert.NoError(err)
+	assert.Equal("query-token", token)
+
+	r.Header.Set("Authorization", "Bearer header-token")
+	token, err = TokenFromRequest(r, "token")
+	assert.NoError(err)
+	assert.Equal("header-token", token)
+
+	r, err = http.NewRequest("GET", "/?eventType=program", nil)
+	assert.NoError(err)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = TokenFromRequest(r, "token")
+	assert.Equal(ErrNoToken, err)
+
+	// NOTE: the empty query doesn't match "?=token"
+	r, err = http.NewRequest("GET", "/?=query-token", nil)
+	assert.NoError(err)
+	_, err = TokenFromRequest(r, "")
+	assert.Equal(ErrNoToken, err)
+	_, err = TokenFromHeader(r)
+	assert.Equal(ErrNoToken, err)
+}
+
+func TestTokenFromContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer grpc-token"))
+	token, err := TokenFromContext(ctx)
+	assert.NoError(err)
+	assert.Equal("grpc-token", token)
+
+	_, err = TokenFromContext(context.Background())
+	assert.Equal(ErrNoToken, err)
+}
+
+func TestWithCertificate(t *testing.T) {
+	certificate := Claims{"sub": "alice", CertificateSubjectClaim: "CN=alice"}
+
+	cases := []struct {
+		Token       Claims
+		Certificate Claims
+		Expect      Claims
+		Err         error
+	}{
+		{
+			Token:       Claims{"sub": "alice", "roles": "viewer"},
+			Certificate: certificate,
+			Expect:      Claims{"sub": "alice", "roles": "viewer", CertificateSubjectClaim: "CN=alice"},
+		},
+		{
+			// NOTE: the token without sub gets the subject of the certificate
+			Token:       Claims{"roles": "viewer"},
+			Certificate: certificate,
+			Expect:      Claims{"sub": "alice", "roles": "viewer", CertificateSubjectClaim: "CN=alice"},
+		},
+		{
+			Token:       Claims{"sub": "admin"},
+			Certificate: certificate,
+			Err:         ErrSubjectMismatch,
+		},
+		{
+			Token:       Claims{"sub": "alice", CertificateSubjectClaim: "CN=admin"},
+			Certificate: certificate,
+			Expect:      Claims{"sub": "alice", CertificateSubjectClaim: "CN=alice"},
+		},
+		{
+			// NOTE: the token can't set the certificate subject without the certificate
+			Token:  Claims{"sub": "admin", CertificateSubjectClaim: "CN=admin"},
+			Expect: Claims{"sub": "admin"},
+		},
+	}
+
+	for _, c := range cases {
+		claims, err := WithCertificate(c.Token, c.Certificate)
+		assert.Equal(t, c.Err, err)
+		assert.Equal(t, c.Expect, claims)
+	}
+}
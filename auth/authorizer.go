@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfresh/plasma/config"
+)
+
+const ClaimsPolicy = "claims"
+
+// Authorizer decides whether a client is allowed to subscribe an event type.
+type Authorizer interface {
+	Authorize(claims Claims, eventType string) bool
+}
+
+func NewAuthorizer(config config.Authorization) (Authorizer, error) {
+	var authorizer Authorizer
+	var err error
+
+	switch config.Type {
+	case ClaimsPolicy:
+		authorizer = newClaimsAuthorizer(config)
+	default:
+		err = fmt.Errorf("unknown authorization type: %s", config.Type)
+	}
+
+	return authorizer, err
+}
+
+// Filter splits event types into allowed ones and denied ones.
+func Filter(authorizer Authorizer, claims Claims, events []string) ([]string, []string) {
+	allowed := make([]string, 0, len(events))
+	var denied []string
+	for _, e := range events {
+		if authorizer.Authorize(claims, e) {
+			allowed = append(allowed, e)
+		} else {
+			denied = append(denied, e)
+		}
+	}
+	return allowed, denied
+}
+
+const eventSeparator = ":"
+
+// NOTE: same as presence.EventPrefix, which can't be imported because of the import cycle
+const presenceEventType = "presence"
+
+// contains reports whether the event type e is parent in the event hierarchy of the event type c or is same.
+// ex) "program:1234" contains "program:1234:views"
+func contains(e, c string) bool {
+	return e == c || strings.HasPrefix(c, e+eventSeparator)
+}
+
+// claimsAuthorizer allows event types listed in the claim of the token.
+// If protected event types are specified, the others are allowed to anyone.
+type claimsAuthorizer struct {
+	claim     string
+	protected []string
+}
+
+func newClaimsAuthorizer(config config.Authorization) claimsAuthorizer {
+	return claimsAuthorizer{
+		claim:     config.Claim,
+		protected: config.Protected,
+	}
+}
+
+func (a claimsAuthorizer) isProtected(eventType string) bool {
+	if len(a.protected) == 0 {
+		return true
+	}
+	for _, p := range a.protected {
+		// NOTE: subscribing a parent event type also receives protected event types
+		if contains(p, eventType) || contains(eventType, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize allows presence event types only if their event types are allowed too,
+// because they reveal the subscribers. ex) presence:program:1234 requires program:1234
+func (a claimsAuthorizer) Authorize(claims Claims, eventType string) bool {
+	if !a.authorize(claims, eventType) {
+		return false
+	}
+	switch {
+	case eventType == presenceEventType:
+		// NOTE: it receives the presence of all event types
+		for _, e := range claims.Strings(a.claim) {
+			if e == "*" {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(eventType, presenceEventType+eventSeparator):
+		return a.authorize(claims, strings.TrimPrefix(eventType, presenceEventType+eventSeparator))
+	}
+	return true
+}
+
+func (a claimsAuthorizer) authorize(claims Claims, eventType string) bool {
+	if !a.isProtected(eventType) {
+		return true
+	}
+	for _, e := range claims.Strings(a.claim) {
+		if e == "*" || contains(e, eventType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimsAuthorizer(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := NewAuthorizer(config.Authorization{
+		Type:      ClaimsPolicy,
+		Claim:     "events",
+		Protected: []string{"program:premium"},
+	})
+	assert.NoError(err)
+
+	entitled := Claims{"events": []interface{}{"program:premium:1234"}}
+	cases := []struct {
+		claims    Claims
+		eventType string
+		expect    bool
+	}{
+		{claims: nil, eventType: "program:free:1", expect: true},
+		{claims: nil, eventType: "program:premium:1234:views", expect: false},
+		// NOTE: a parent event type receives the protected ones
+		{claims: nil, eventType: "program", expect: false},
+		{claims: entitled, eventType: "program:premium:1234", expect: true},
+		{claims: entitled, eventType: "program:premium:1234:views", expect: true},
+		{claims: entitled, eventType: "program:premium:5678", expect: false},
+		{claims: entitled, eventType: "program:premium", expect: false},
+		{claims: Claims{"events": "*"}, eventType: "program", expect: true},
+		// NOTE: presence event types require their event types
+		{claims: nil, eventType: "presence:program:free:1", expect: true},
+		{claims: nil, eventType: "presence:program:premium:1234", expect: false},
+		{claims: nil, eventType: "presence:program", expect: false},
+		{claims: entitled, eventType: "presence:program:premium:1234", expect: true},
+		{claims: nil, eventType: "presence", expect: false},
+		{claims: Claims{"events": "*"}, eventType: "presence", expect: true},
+	}
+
+	for _, c := range cases {
+		assert.Equal(c.expect, a.Authorize(c.claims, c.eventType), c.eventType)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newClaimsAuthorizer(config.Authorization{Claim: "events"})
+	allowed, denied := Filter(a, Claims{"events": "program:1234"}, []string{"program:1234:views", "program:5678:views"})
+	assert.Equal([]string{"program:1234:views"}, allowed)
+	assert.Equal([]string{"program:5678:views"}, denied)
+}
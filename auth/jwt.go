@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+type jwtAuthenticator struct {
+	keys     []key
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func newJWTAuthenticator(config config.JWT) (*jwtAuthenticator, error) {
+	keys, err := loadKeys(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys to verify JWT, specify secret file, public key file or JWKS file")
+	}
+
+	return &jwtAuthenticator{
+		keys:     keys,
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		leeway:   config.Leeway,
+		now:      time.Now,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (a *jwtAuthenticator) Authenticate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrInvalidToken, "malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "failed to decode header: %s", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "failed to decode signature: %s", err)
+	}
+	if err := a.verify(header, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "failed to decode claims: %s", err)
+	}
+	if err := a.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *jwtAuthenticator) verify(header jwtHeader, signed, sig []byte) error {
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return errors.Wrapf(ErrInvalidToken, "unsupported algorithm: %s", header.Alg)
+	}
+
+	for _, k := range a.keys {
+		if header.Kid != "" && k.id != "" && header.Kid != k.id {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		if alg(k.public, signed, sig) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrInvalidToken, "signature is invalid")
+}
+
+// numericDate returns false if the claim isn't present. It returns an error if the claim isn't a number
+// not to skip the validation of a crafted token, ex) "exp": "1"
+func numericDate(claims Claims, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false, errors.Wrapf(ErrInvalidToken, "%s is not a number", name)
+	}
+	return time.Unix(int64(f), 0), true, nil
+}
+
+func (a *jwtAuthenticator) validate(claims Claims) error {
+	now := a.now()
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(exp.Add(a.leeway)) {
+		return errors.Wrap(ErrInvalidToken, "token is expired")
+	}
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Before(nbf.Add(-a.leeway)) {
+		return errors.Wrap(ErrInvalidToken, "token is not valid yet")
+	}
+	if a.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.issuer {
+			return errors.Wrapf(ErrInvalidToken, "unexpected issuer: %s", iss)
+		}
+	}
+	if a.audience != "" {
+		found := false
+		for _, aud := range claims.Strings("aud") {
+			if aud == a.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Wrap(ErrInvalidToken, "unexpected audience")
+		}
+	}
+	return nil
+}
+
+type algorithm func(public interface{}, signed, sig []byte) bool
+
+func newHMAC(hash crypto.Hash) algorithm {
+	return func(public interface{}, signed, sig []byte) bool {
+		secret, ok := public.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	}
+}
+
+func digest(hash crypto.Hash, signed []byte) []byte {
+	h := hash.New()
+	h.Write(signed)
+	return h.Sum(nil)
+}
+
+func newRSA(hash crypto.Hash) algorithm {
+	return func(public interface{}, signed, sig []byte) bool {
+		pub, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest(hash, signed), sig) == nil
+	}
+}
+
+func newRSAPSS(hash crypto.Hash) algorithm {
+	return func(public interface{}, signed, sig []byte) bool {
+		pub, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		return rsa.VerifyPSS(pub, hash, digest(hash, signed), sig, nil) == nil
+	}
+}
+
+func newECDSA(hash crypto.Hash, keySize int) algorithm {
+	return func(public interface{}, signed, sig []byte) bool {
+		pub, ok := public.(*ecdsa.PublicKey)
+		if !ok || (pub.Curve.Params().BitSize+7)/8 != keySize || len(sig) != 2*keySize {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:keySize])
+		s := new(big.Int).SetBytes(sig[keySize:])
+		return ecdsa.Verify(pub, digest(hash, signed), r, s)
+	}
+}
+
+// NOTE: "none" is never accepted.
+var algorithms = map[string]algorithm{
+	"HS256": newHMAC(crypto.SHA256),
+	"HS384": newHMAC(crypto.SHA384),
+	"HS512": newHMAC(crypto.SHA512),
+	"RS256": newRSA(crypto.SHA256),
+	"RS384": newRSA(crypto.SHA384),
+	"RS512": newRSA(crypto.SHA512),
+	"PS256": newRSAPSS(crypto.SHA256),
+	"PS384": newRSAPSS(crypto.SHA384),
+	"PS512": newRSAPSS(crypto.SHA512),
+	"ES256": newECDSA(crypto.SHA256, 32),
+	"ES384": newECDSA(crypto.SHA384, 48),
+	"ES512": newECDSA(crypto.SHA512, 66),
+}
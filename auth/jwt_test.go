@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func sign(t *testing.T, alg, kid string, claims Claims, private interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+
+	var sig []byte
+	switch k := private.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest(crypto.SHA256, []byte(signed)))
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest(crypto.SHA256, []byte(signed)))
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeFile(t *testing.T, dir, name string, b []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, b, 0600))
+	return path
+}
+
+func writePublicKey(t *testing.T, dir, name string, pub interface{}) string {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return writeFile(t, dir, name, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plasma-auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	valid := Claims{"sub": "user-1", "exp": float64(time.Now().Add(time.Hour).Unix())}
+	expired := Claims{"sub": "user-1", "exp": float64(time.Now().Add(-time.Hour).Unix())}
+
+	cases := []struct {
+		name   string
+		config config.JWT
+		token  string
+		isErr  bool
+	}{
+		{
+			name:   "HS256",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret-newline", append(secret, '\n'))},
+			token:  sign(t, "HS256", "", valid, secret),
+		},
+		{
+			name:   "RS256",
+			config: config.JWT{PublicKeyFile: writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)},
+			token:  sign(t, "RS256", "", valid, rsaKey),
+		},
+		{
+			name:   "ES256",
+			config: config.JWT{PublicKeyFile: writePublicKey(t, dir, "ec.pem", &ecKey.PublicKey)},
+			token:  sign(t, "ES256", "", valid, ecKey),
+		},
+		{
+			name:   "expired",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret)},
+			token:  sign(t, "HS256", "", expired, secret),
+			isErr:  true,
+		},
+		{
+			name:   "exp is not a number",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret)},
+			token:  sign(t, "HS256", "", Claims{"sub": "user-1", "exp": "1"}, secret),
+			isErr:  true,
+		},
+		{
+			name:   "nbf is not a number",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret)},
+			token:  sign(t, "HS256", "", Claims{"sub": "user-1", "nbf": "1"}, secret),
+			isErr:  true,
+		},
+		{
+			name:   "wrong key",
+			config: config.JWT{PublicKeyFile: writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)},
+			token:  sign(t, "RS256", "", valid, otherKey),
+			isErr:  true,
+		},
+		{
+			// NOTE: the public key must not be used as a HMAC secret
+			name:   "algorithm confusion",
+			config: config.JWT{PublicKeyFile: writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)},
+			token:  sign(t, "HS256", "", valid, []byte("dummy")),
+			isErr:  true,
+		},
+		{
+			name:   "none",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret)},
+			token:  encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, valid) + ".",
+			isErr:  true,
+		},
+		{
+			name:   "issuer",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret), Issuer: "plasma"},
+			token:  sign(t, "HS256", "", valid, secret),
+			isErr:  true,
+		},
+		{
+			name:   "audience",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret), Audience: "plasma"},
+			token:  sign(t, "HS256", "", Claims{"sub": "user-1", "aud": []string{"other", "plasma"}}, secret),
+		},
+		{
+			name:   "malformed",
+			config: config.JWT{SecretFile: writeFile(t, dir, "secret", secret)},
+			token:  "token",
+			isErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		a, err := newJWTAuthenticator(c.config)
+		require.NoError(t, err, c.name)
+
+		claims, err := a.Authenticate(c.token)
+		if c.isErr {
+			assert.Error(t, err, c.name)
+			assert.Equal(t, ErrInvalidToken, errors.Cause(err), c.name)
+			continue
+		}
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, "user-1", claims.Subject(), c.name)
+	}
+}
+
+func TestJWTAuthenticateJWKS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plasma-auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	b64 := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	jwks := map[string][]map[string]string{
+		"keys": {
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   b64(rsaKey.N),
+				"e":   b64(big.NewInt(int64(rsaKey.E))),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   b64(ecKey.X),
+				"y":   b64(ecKey.Y),
+			},
+		},
+	}
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	a, err := newJWTAuthenticator(config.JWT{JWKSFile: writeFile(t, dir, "jwks.json", b)})
+	require.NoError(t, err)
+
+	claims := Claims{"sub": "user-1"}
+
+	_, err = a.Authenticate(sign(t, "RS256", "rsa", claims, rsaKey))
+	assert.NoError(t, err)
+	_, err = a.Authenticate(sign(t, "ES256", "ec", claims, ecKey))
+	assert.NoError(t, err)
+	_, err = a.Authenticate(sign(t, "RS256", "ec", claims, rsaKey))
+	assert.Error(t, err)
+}
+
+func TestNoKeys(t *testing.T) {
+	_, err := New(config.Auth{Type: JWT})
+	assert.Error(t, err)
+}
+
+func TestEmptySecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plasma-auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = New(config.Auth{Type: JWT, JWT: config.JWT{SecretFile: writeFile(t, dir, "secret", []byte("\n"))}})
+	assert.Error(t, err)
+	_, err = New(config.Auth{Type: JWT, JWT: config.JWT{JWKSFile: writeFile(t, dir, "jwks.json", []byte(`{"keys": [{"kty": "oct", "k": ""}]}`))}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+type key struct {
+	id     string
+	alg    string
+	public interface{}
+}
+
+func loadKeys(config config.JWT) ([]key, error) {
+	keys := make([]key, 0)
+
+	if config.SecretFile != "" {
+		b, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read secret file: %s", config.SecretFile)
+		}
+		secret := bytes.TrimRight(b, "\r\n")
+		// NOTE: anyone can sign tokens with an empty secret
+		if len(secret) == 0 {
+			return nil, errors.Errorf("secret file is empty: %s", config.SecretFile)
+		}
+		keys = append(keys, key{public: secret})
+	}
+
+	if config.PublicKeyFile != "" {
+		b, err := ioutil.ReadFile(config.PublicKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read public key file: %s", config.PublicKeyFile)
+		}
+		pub, err := parsePublicKey(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key file: %s", config.PublicKeyFile)
+		}
+		keys = append(keys, key{public: pub})
+	}
+
+	if config.JWKSFile != "" {
+		b, err := ioutil.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read JWKS file: %s", config.JWKSFile)
+		}
+		ks, err := parseJWKS(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse JWKS file: %s", config.JWKSFile)
+		}
+		keys = append(keys, ks...)
+	}
+
+	return keys, nil
+}
+
+func parsePublicKey(b []byte) (interface{}, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		var pub struct {
+			N *big.Int
+			E int
+		}
+		if _, err := asn1.Unmarshal(block.Bytes, &pub); err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: pub.N, E: pub.E}, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM type: %s", block.Type)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+func parseJWKS(b []byte) ([]key, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make([]key, 0, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		// NOTE: keys for encryption are not used to verify signatures
+		if k.Use == "enc" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key: kid=%s", k.Kid)
+		}
+		keys = append(keys, key{id: k.Kid, alg: k.Alg, public: pub})
+	}
+
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty secret")
+		}
+		return secret, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
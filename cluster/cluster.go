@@ -0,0 +1,182 @@
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/pkg/errors"
+)
+
+// store keeps the records of the nodes. A record expires if it isn't put again within the TTL.
+type store interface {
+	put(node metrics.NodeStats, ttl time.Duration) error
+	remove(id string) error
+	nodes() ([]metrics.NodeStats, error)
+}
+
+// Cluster heartbeats the stats of this node, and collects the stats of all live nodes.
+type Cluster struct {
+	id          string
+	store       store
+	interval    time.Duration
+	ttl         time.Duration
+	startedAt   time.Time
+	errorLogger *zap.Logger
+	stats       func(id string, startedAt time.Time) metrics.NodeStats
+
+	mu       sync.Mutex
+	presence func() map[string]int64
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func New(config config.Config, errorLogger *zap.Logger) (*Cluster, error) {
+	var s store
+	switch config.Cluster.Type {
+	case "redis":
+		s = newRedisStore(config.Cluster)
+	default:
+		return nil, fmt.Errorf("unknown cluster type: %s", config.Cluster.Type)
+	}
+
+	id := config.Cluster.NodeID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get hostname for the node ID")
+		}
+		id = hostname
+	}
+	return newCluster(id, s, config.Cluster, errorLogger), nil
+}
+
+func newCluster(id string, s store, config config.Cluster, errorLogger *zap.Logger) *Cluster {
+	return &Cluster{
+		id:          id,
+		store:       s,
+		interval:    config.Interval,
+		ttl:         config.TTL,
+		startedAt:   time.Now(),
+		errorLogger: errorLogger,
+		stats:       metrics.GetNodeStats,
+	}
+}
+
+// ID returns the ID of this node.
+func (c *Cluster) ID() string {
+	return c.id
+}
+
+// Start joins the cluster and heartbeats until Stop is called.
+func (c *Cluster) Start() {
+	c.mu.Lock()
+	if c.done != nil {
+		c.mu.Unlock()
+		return
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	c.done, c.stopped = done, stopped
+	c.mu.Unlock()
+
+	c.heartbeat()
+	go c.run(done, stopped)
+}
+
+func (c *Cluster) run(done, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.heartbeat()
+		case <-done:
+			return
+		}
+	}
+}
+
+// SetPresence shares the presence counts of this node in the heartbeats.
+func (c *Cluster) SetPresence(presence func() map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.presence = presence
+}
+
+func (c *Cluster) heartbeat() {
+	node := c.stats(c.id, c.startedAt)
+	c.mu.Lock()
+	presence := c.presence
+	c.mu.Unlock()
+	if presence != nil {
+		node.Presence = presence()
+	}
+	// NOTE: the node disappears from the others after TTL if it keeps failing
+	if err := c.store.put(node, c.ttl); err != nil {
+		c.errorLogger.Error("failed to heartbeat to the cluster",
+			zap.Error(err),
+			zap.String("node-id", c.id),
+		)
+	}
+}
+
+// Stop stops the heartbeat and leaves the cluster, so that the others don't wait for the record to expire.
+func (c *Cluster) Stop() {
+	c.mu.Lock()
+	done, stopped := c.done, c.stopped
+	c.done = nil
+	c.mu.Unlock()
+	if done == nil {
+		return
+	}
+	close(done)
+	<-stopped
+	if err := c.store.remove(c.id); err != nil {
+		c.errorLogger.Error("failed to leave the cluster",
+			zap.Error(err),
+			zap.String("node-id", c.id),
+		)
+	}
+}
+
+// Nodes returns the stats of the live nodes, which are sent by the last heartbeats.
+func (c *Cluster) Nodes() ([]metrics.NodeStats, error) {
+	nodes, err := c.store.nodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the nodes of the cluster")
+	}
+	return nodes, nil
+}
+
+// Stats returns the sum of the live nodes.
+func (c *Cluster) Stats() (*metrics.ClusterStats, error) {
+	nodes, err := c.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	return metrics.NewClusterStats(nodes), nil
+}
+
+// RemotePresence returns the sum of the presence counts of the other nodes.
+func (c *Cluster) RemotePresence() (map[string]int64, error) {
+	nodes, err := c.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, n := range nodes {
+		if n.ID == c.id {
+			continue
+		}
+		for e, v := range n.Presence {
+			counts[e] += v
+		}
+	}
+	return counts, nil
+}
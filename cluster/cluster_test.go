@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is the store shared by the nodes in the test. The records expire by now.
+type memoryStore struct {
+	mu      sync.Mutex
+	now     time.Time
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	node      metrics.NodeStats
+	expiresAt time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		now:     time.Now(),
+		records: make(map[string]memoryRecord),
+	}
+}
+
+func (s *memoryStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *memoryStore) put(node metrics.NodeStats, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[node.ID] = memoryRecord{node: node, expiresAt: s.now.Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+func (s *memoryStore) nodes() ([]metrics.NodeStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := []metrics.NodeStats{}
+	for _, r := range s.records {
+		if s.now.Before(r.expiresAt) {
+			nodes = append(nodes, r.node)
+		}
+	}
+	return nodes, nil
+}
+
+func newTestCluster(t *testing.T, id string, s store, connections int64, subscribers map[string]int64) *Cluster {
+	l, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	require.NoError(t, err)
+	c := newCluster(id, s, config.Cluster{Interval: time.Hour, TTL: 3 * time.Second}, l)
+	c.stats = func(id string, startedAt time.Time) metrics.NodeStats {
+		return metrics.NodeStats{
+			ID:             id,
+			StartedAt:      startedAt.UnixNano(),
+			Connections:    connections,
+			ConnectionsSSE: connections,
+			Subscribers:    subscribers,
+		}
+	}
+	return c
+}
+
+func TestClusterStats(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newMemoryStore()
+	node1 := newTestCluster(t, "node1", s, 2, map[string]int64{"program:1234": 2})
+	node2 := newTestCluster(t, "node2", s, 3, map[string]int64{"program:1234": 1, "program:5678": 2})
+	node1.Start()
+	defer node1.Stop()
+	node2.Start()
+	defer node2.Stop()
+
+	stats, err := node1.Stats()
+	require.NoError(t, err)
+	assert.Equal(2, stats.NodeNum)
+	assert.Equal(int64(5), stats.Connections)
+	assert.Equal(int64(5), stats.ConnectionsSSE)
+	assert.Equal(map[string]int64{"program:1234": 3, "program:5678": 2}, stats.Subscribers)
+	require.Len(t, stats.Nodes, 2)
+	assert.Equal("node1", stats.Nodes[0].ID)
+	assert.Equal("node2", stats.Nodes[1].ID)
+}
+
+func TestClusterExpire(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newMemoryStore()
+	node1 := newTestCluster(t, "node1", s, 1, nil)
+	node2 := newTestCluster(t, "node2", s, 1, nil)
+	node1.Start()
+	defer node1.Stop()
+	node2.Start()
+
+	// NOTE: the stopped node leaves the cluster at once
+	node2.Stop()
+	nodes, err := node1.Nodes()
+	require.NoError(t, err)
+	assert.Len(nodes, 1)
+
+	// NOTE: a node which stops heartbeating without leaving disappears after TTL
+	node2.heartbeat()
+	s.advance(2 * time.Second)
+	node1.heartbeat()
+	nodes, err = node1.Nodes()
+	require.NoError(t, err)
+	assert.Len(nodes, 2)
+
+	s.advance(2 * time.Second)
+	nodes, err = node1.Nodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal("node1", nodes[0].ID)
+}
+
+func TestRemotePresence(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newMemoryStore()
+	node1 := newTestCluster(t, "node1", s, 1, nil)
+	node2 := newTestCluster(t, "node2", s, 1, nil)
+	node3 := newTestCluster(t, "node3", s, 1, nil)
+	node1.SetPresence(func() map[string]int64 { return map[string]int64{"program:1234": 1} })
+	node2.SetPresence(func() map[string]int64 { return map[string]int64{"program:1234": 2} })
+	node3.SetPresence(func() map[string]int64 { return map[string]int64{"program:1234": 3, "program:5678": 1} })
+	for _, n := range []*Cluster{node1, node2, node3} {
+		n.Start()
+		defer n.Stop()
+	}
+
+	// NOTE: the counts of this node are excluded
+	counts, err := node1.RemotePresence()
+	require.NoError(t, err)
+	assert.Equal(map[string]int64{"program:1234": 5, "program:5678": 1}, counts)
+}
@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/pkg/errors"
+)
+
+// redisStore keeps each record in a key with the TTL, and the IDs in a set to find the keys without SCAN.
+// ex) plasma:cluster:nodes is the set, and plasma:cluster:node:<id> is the record
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisStore(config config.Cluster) *redisStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Redis.Addr,
+		Password: config.Redis.Password.Value(),
+		DB:       config.Redis.DB,
+	})
+	return &redisStore{
+		client: client,
+		prefix: config.KeyPrefix,
+	}
+}
+
+func (s *redisStore) nodesKey() string {
+	return s.prefix + ":nodes"
+}
+
+func (s *redisStore) nodeKey(id string) string {
+	return s.prefix + ":node:" + id
+}
+
+func (s *redisStore) put(node metrics.NodeStats, ttl time.Duration) error {
+	b, err := json.Marshal(node)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the node")
+	}
+	if err := s.client.Set(s.nodeKey(node.ID), b, ttl).Err(); err != nil {
+		return errors.Wrapf(err, "failed to set the node: %s", node.ID)
+	}
+	if err := s.client.SAdd(s.nodesKey(), node.ID).Err(); err != nil {
+		return errors.Wrapf(err, "failed to add the node: %s", node.ID)
+	}
+	return nil
+}
+
+func (s *redisStore) remove(id string) error {
+	if err := s.client.Del(s.nodeKey(id)).Err(); err != nil {
+		return errors.Wrapf(err, "failed to delete the node: %s", id)
+	}
+	return s.client.SRem(s.nodesKey(), id).Err()
+}
+
+func (s *redisStore) nodes() ([]metrics.NodeStats, error) {
+	ids, err := s.client.SMembers(s.nodesKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []metrics.NodeStats{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.nodeKey(id)
+	}
+	values, err := s.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]metrics.NodeStats, 0, len(ids))
+	var expired []interface{}
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			// NOTE: the record of a stale node has expired
+			expired = append(expired, ids[i])
+			continue
+		}
+		var node metrics.NodeStats
+		if err := json.Unmarshal([]byte(str), &node); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal the node: %s", ids[i])
+		}
+		nodes = append(nodes, node)
+	}
+	if len(expired) != 0 {
+		// NOTE: a node which heartbeats again is added back, so it is fine to fail
+		s.client.SRem(s.nodesKey(), expired...)
+	}
+	return nodes, nil
+}
@@ -2,52 +2,77 @@ package config
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"go.uber.org/zap/zapcore"
-
-	"github.com/kelseyhightower/envconfig"
 )
 
+// New loads the config from the environment variables. It panics if the config is invalid.
 func New() Config {
-	config := Config{}
-	envconfig.MustProcess("plasma", &config)
-
-	if config.AccessLog.Out == "" {
-		config.AccessLog.Out = "stdout"
-	}
-	if config.ErrorLog.Out == "" {
-		config.ErrorLog.Out = "stderr"
-	}
-	if config.AccessLog.Level == "" {
-		config.AccessLog.Level = "debug"
-	}
-
-	if config.ErrorLog.Level == "" {
-		config.ErrorLog.Level = "debug"
+	config, err := Load("")
+	if err != nil {
+		panic(err)
 	}
-
 	return config
 }
 
 type Config struct {
-	AccessLog   Log `envconfig:"ACCESS_LOG"`
-	ErrorLog    Log `envconfig:"ERROR_LOG"`
-	Debug       bool
-	Origin      string
-	Port        string `default:"8080"`
-	GrpcPort    string `default:"50051"`
-	MerticsPort string `default:"9999"`
-	SSE         ServerSentEvent
-	Subscriber  Subscriber
-	TLS         Cert `envconfig:"TLS"`
-	Metrics     Metrics
-	Pprof       Pprof
+	AccessLog    Log `envconfig:"ACCESS_LOG"`
+	ErrorLog     Log `envconfig:"ERROR_LOG"`
+	Debug        bool
+	Origin       string // Deprecated: use CORS.AllowedOrigins
+	CORS         CORS
+	Port         string `default:"8080"`
+	GrpcPort     string `default:"50051"`
+	MerticsPort  string `default:"9999"`
+	SSE          ServerSentEvent
+	Subscriber   Subscriber
+	TLS          Cert `envconfig:"TLS"`
+	Metrics      Metrics
+	Pprof        Pprof
+	Auth         Auth
+	Limit        Limit
+	Subscription Subscription
+	Tracing      Tracing
+	Admin        Admin
+	Drain        Drain
+	Health       Health
+	Cluster      Cluster
+	Presence     Presence
+	// NOTE: X-Forwarded-For is respected only from these proxies
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
 }
 
 type ServerSentEvent struct {
-	Retry      int    `default:"2000"`
-	EventQuery string `default:"eventType"`
+	Retry             int           `default:"2000"`
+	EventQuery        string        `default:"eventType"`
+	HeartbeatInterval time.Duration `default:"10s" envconfig:"HEARTBEAT_INTERVAL"`
+}
+
+type CORS struct {
+	AllowedOrigins   []string      `envconfig:"ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `default:"GET,POST" envconfig:"ALLOWED_METHODS"`
+	AllowedHeaders   []string      `default:"Authorization,Content-Type,Last-Event-ID" envconfig:"ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `default:"X-Plasma-Denied-Events" envconfig:"EXPOSED_HEADERS"`
+	AllowCredentials bool          `envconfig:"ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `default:"10m" envconfig:"MAX_AGE"`
+}
+
+type Tracing struct {
+	Endpoint    string
+	ServiceName string        `default:"plasma" envconfig:"SERVICE_NAME"`
+	SampleRate  float64       `default:"1" envconfig:"SAMPLE_RATE"`
+	BatchSize   int           `default:"512" envconfig:"BATCH_SIZE"`
+	Interval    time.Duration `default:"5s"`
+	Timeout     time.Duration `default:"10s"`
+}
+
+type Subscription struct {
+	MaxEvents      int    `default:"100" envconfig:"MAX_EVENTS"`
+	MaxEventLength int    `default:"256" envconfig:"MAX_EVENT_LENGTH"`
+	MaxDepth       int    `default:"8" envconfig:"MAX_DEPTH"`
+	AllowedChars   string `default:"A-Za-z0-9_.-" envconfig:"ALLOWED_CHARS"`
 }
 
 type Subscriber struct {
@@ -73,6 +98,10 @@ type OverMaxRetryBehavior struct {
 	Type string
 }
 
+func (b OverMaxRetryBehavior) MarshalText() ([]byte, error) {
+	return []byte(b.Type), nil
+}
+
 func (b *OverMaxRetryBehavior) UnmarshalText(text []byte) error {
 	switch string(text) {
 	case OverMaxRetryBehaviorAlive:
@@ -93,37 +122,154 @@ const (
 
 type Redis struct {
 	Addr                 string `default:"localhost:6379"`
-	Password             string
+	Password             Secret
 	DB                   int
 	Channels             Channels
 	OverMaxRetryBehavior OverMaxRetryBehavior `envconfig:"OVER_MAX_RETRY_BEHAVIOR"`
 	MaxRetry             int                  `default:"5"`
 	Timeout              time.Duration        `default:"1s"`
 	RetryInterval        time.Duration        `default:"5s" envconfig:"RETRY_INTERVAL"`
+	Mode                 string               `default:"static"`
+	ChannelPrefix        string               `envconfig:"CHANNEL_PREFIX"`
 }
 
+// Modes of the redis subscriber. The interest mode subscribes to the channels of the event types
+// which have local subscribers, named ChannelPrefix + event type, in addition to Channels.
+const (
+	RedisModeStatic   = "static"
+	RedisModeInterest = "interest"
+)
+
 func (r Redis) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("Addr", r.Addr)
-	enc.AddString("Password", r.Password)
+	enc.AddString("Password", r.Password.String())
 	enc.AddInt("DB", r.DB)
+	enc.AddString("Mode", r.Mode)
 	return enc.AddArray("Channels", r.Channels)
 }
 
 type Log struct {
-	Out   string
-	Level string
+	Out      string
+	Level    string
+	Encoding string
+	Tee      LogSinks
+	Rotate   Rotate
+	Sampling LogSampling
+}
+
+// LogSampling logs the first Initial entries with the same level and message in each Tick,
+// and every Thereafter-th entry after that. Zero Initial disables sampling.
+type LogSampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration `default:"1s"`
+}
+
+// LogSink is an additional output of a logger. Level and Encoding default to the logger's ones.
+type LogSink struct {
+	Out      string
+	Level    string
+	Encoding string
+}
+
+// LogSinks are written as "out[:level[:encoding]]" separated by comma.
+// ex) "stdout:info:console,/var/log/plasma/error.log"
+type LogSinks []LogSink
+
+func (ss LogSinks) MarshalText() ([]byte, error) {
+	sinks := make([]string, len(ss))
+	for i, s := range ss {
+		sinks[i] = strings.TrimRight(strings.Join([]string{s.Out, s.Level, s.Encoding}, ":"), ":")
+	}
+	return []byte(strings.Join(sinks, ",")), nil
+}
+
+func (ss *LogSinks) UnmarshalText(text []byte) error {
+	*ss = nil
+	if len(text) == 0 {
+		return nil
+	}
+	for _, sink := range strings.Split(string(text), ",") {
+		var s LogSink
+		if err := s.UnmarshalText([]byte(sink)); err != nil {
+			return err
+		}
+		*ss = append(*ss, s)
+	}
+	return nil
+}
+
+// UnmarshalText decodes a sink from "out[:level[:encoding]]", so that the sinks can be listed in the config file.
+func (s *LogSink) UnmarshalText(text []byte) error {
+	values := strings.Split(string(text), ":")
+	if len(values) > 3 || values[0] == "" {
+		return errors.New("invalid log sink: " + string(text))
+	}
+	values = append(values, "", "")
+	*s = LogSink{
+		Out:      values[0],
+		Level:    values[1],
+		Encoding: values[2],
+	}
+	return nil
+}
+
+// Rotate rotates log files when they exceed MaxSize megabytes or Interval passes.
+// Backups over MaxBackups or older than MaxAge are removed. Zero values mean no limit.
+type Rotate struct {
+	Interval   time.Duration
+	MaxSize    int           `envconfig:"MAX_SIZE"`
+	MaxBackups int           `envconfig:"MAX_BACKUPS"`
+	MaxAge     time.Duration `envconfig:"MAX_AGE"`
 }
 
 type Cert struct {
-	CertFile string `envconfig:"CERT_FILE"`
-	KeyFile  string `envconfig:"KEY_FILE"`
+	CertFile       string        `envconfig:"CERT_FILE"`
+	KeyFile        string        `envconfig:"KEY_FILE"`
+	ClientCAFile   string        `envconfig:"CLIENT_CA_FILE"`
+	ClientAuth     ClientAuth    `envconfig:"CLIENT_AUTH"`
+	ReloadInterval time.Duration `default:"1m" envconfig:"RELOAD_INTERVAL"`
+}
+
+type ClientAuth struct {
+	Type string
+}
+
+func (a ClientAuth) MarshalText() ([]byte, error) {
+	return []byte(a.Type), nil
+}
+
+func (a *ClientAuth) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case ClientAuthNone, ClientAuthRequest, ClientAuthRequire, ClientAuthVerifyIfGiven, ClientAuthRequireAndVerify:
+		a.Type = string(text)
+	default:
+		return errors.New("unknown ClientAuth type: " + string(text))
+	}
+
+	return nil
 }
 
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"
+	ClientAuthRequire          = "require"
+	ClientAuthVerifyIfGiven    = "verify_if_given"
+	ClientAuthRequireAndVerify = "require_and_verify"
+)
+
 type Metrics struct {
-	Type     string
-	Log      LogMetrics
-	Syslog   SyslogMetrics
-	Interval time.Duration `default:"10s"`
+	Type      string
+	Log       LogMetrics
+	Syslog    SyslogMetrics
+	Statsd    StatsdMetrics
+	EventType EventTypeMetrics `envconfig:"EVENT_TYPE"`
+	Interval  time.Duration    `default:"10s"`
+}
+
+type EventTypeMetrics struct {
+	Max   int `default:"1000"`
+	Depth int `default:"2"`
 }
 
 type LogMetrics struct {
@@ -131,6 +277,7 @@ type LogMetrics struct {
 	Prefix   string        `default:"metrics"`
 	Flag     int           `default:"4"`
 	Interval time.Duration `default:"1m"`
+	Rotate   Rotate
 }
 
 type SyslogMetrics struct {
@@ -142,6 +289,111 @@ type SyslogMetrics struct {
 	Addr     string
 }
 
+type StatsdMetrics struct {
+	Addr      string        `default:"localhost:8125"`
+	Prefix    string        `default:"plasma."`
+	Interval  time.Duration `default:"10s"`
+	DogStatsD bool          `envconfig:"DOGSTATSD"`
+	Tags      []string
+}
+
+type Auth struct {
+	Type          string
+	Query         string `default:"token"`
+	JWT           JWT
+	Authorization Authorization
+}
+
+type JWT struct {
+	SecretFile    string `envconfig:"SECRET_FILE"`
+	PublicKeyFile string `envconfig:"PUBLIC_KEY_FILE"`
+	JWKSFile      string `envconfig:"JWKS_FILE"`
+	Issuer        string
+	Audience      string
+	Leeway        time.Duration
+}
+
+type DeniedBehavior struct {
+	Type string
+}
+
+func (b DeniedBehavior) MarshalText() ([]byte, error) {
+	return []byte(b.Type), nil
+}
+
+func (b *DeniedBehavior) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case DeniedBehaviorReject:
+		b.Type = DeniedBehaviorReject
+	case DeniedBehaviorDrop:
+		b.Type = DeniedBehaviorDrop
+	default:
+		return errors.New("unknown DeniedBehavior type: " + string(text))
+	}
+
+	return nil
+}
+
+const (
+	DeniedBehaviorReject = "reject"
+	DeniedBehaviorDrop   = "drop"
+)
+
+type Authorization struct {
+	Type           string
+	Claim          string `default:"events"`
+	Protected      []string
+	DeniedBehavior DeniedBehavior `default:"reject" envconfig:"DENIED_BEHAVIOR"`
+}
+
+type Limit struct {
+	MaxConnections        int     `envconfig:"MAX_CONNECTIONS"`
+	MaxConnectionsSSE     int     `envconfig:"MAX_CONNECTIONS_SSE"`
+	MaxConnectionsGRPC    int     `envconfig:"MAX_CONNECTIONS_GRPC"`
+	MaxConnectionsPerAddr int     `envconfig:"MAX_CONNECTIONS_PER_ADDR"`
+	ConnectRate           float64 `envconfig:"CONNECT_RATE"`
+	ConnectBurst          int     `envconfig:"CONNECT_BURST" default:"10"`
+}
+
+type Admin struct {
+	TokenFile string `envconfig:"TOKEN_FILE"`
+}
+
+type Drain struct {
+	Timeout     time.Duration `default:"30s"`
+	Waves       int           `default:"5"`
+	Interval    time.Duration `default:"1s"`
+	RetryJitter time.Duration `default:"5s" envconfig:"RETRY_JITTER"`
+}
+
+type Health struct {
+	FanOutTimeout time.Duration `default:"5s" envconfig:"FAN_OUT_TIMEOUT"`
+}
+
+// Cluster shares the stats of the nodes via Redis. Each node writes its record every Interval,
+// and the record expires after TTL if the node stops. NodeID defaults to the hostname.
+type Cluster struct {
+	Type      string
+	NodeID    string        `envconfig:"NODE_ID"`
+	Interval  time.Duration `default:"5s"`
+	TTL       time.Duration `default:"15s"`
+	KeyPrefix string        `default:"plasma:cluster" envconfig:"KEY_PREFIX"`
+	Redis     ClusterRedis
+}
+
+type ClusterRedis struct {
+	Addr     string `default:"localhost:6379"`
+	Password Secret
+	DB       int
+}
+
+// Presence publishes the number of subscribers of the event types under EventTypes as presence:<event type>.
+// ex) "program" publishes presence:program:1234 when a client subscribes to program:1234
+type Presence struct {
+	EventTypes []string      `envconfig:"EVENT_TYPES"`
+	Interval   time.Duration `default:"1s"`
+}
+
 type Pprof struct {
 	Host string `default:"0.0.0.0"`
 	Port string `default:"6060"`
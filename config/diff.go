@@ -0,0 +1,28 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the keys of the settings which differ between the configs, ex) "sse.retry", "subscriber.redis.channels"
+// The keys are in the same form as the config file.
+func Diff(a, b Config) []string {
+	var keys []string
+	diff(reflect.ValueOf(a), reflect.ValueOf(b), "", &keys)
+	return keys
+}
+
+func diff(a, b reflect.Value, path string, keys *[]string) {
+	if isLeaf(a.Type()) {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*keys = append(*keys, path)
+		}
+		return
+	}
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.TrimPrefix(path+"."+lowerCamel(t.Field(i).Name), ".")
+		diff(a.Field(i), b.Field(i), key, keys)
+	}
+}
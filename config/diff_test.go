@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	base := Config{
+		Port: "8080",
+		SSE:  ServerSentEvent{Retry: 2000},
+		Subscriber: Subscriber{
+			Redis: Redis{Channels: Channels{"plasma"}},
+		},
+		TLS: Cert{ClientAuth: ClientAuth{Type: "request"}},
+	}
+
+	cases := []struct {
+		change func(c *Config)
+		expect []string
+	}{
+		{change: func(c *Config) {}},
+		{
+			change: func(c *Config) {
+				c.Port = "8081"
+				c.SSE.Retry = 3000
+				c.SSE.HeartbeatInterval = time.Second
+			},
+			expect: []string{"port", "sse.retry", "sse.heartbeatInterval"},
+		},
+		{
+			change: func(c *Config) { c.Subscriber.Redis.Channels = Channels{"plasma", "plasma2"} },
+			expect: []string{"subscriber.redis.channels"},
+		},
+		{
+			change: func(c *Config) { c.TLS.ClientAuth.Type = "require" },
+			expect: []string{"tls.clientAuth"},
+		},
+	}
+
+	for _, c := range cases {
+		next := base
+		next.Subscriber.Redis.Channels = append(Channels{}, base.Subscriber.Redis.Channels...)
+		c.change(&next)
+		assert.Equal(t, c.expect, Diff(base, next))
+	}
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "plasma"
+
+// Load loads the config from the file and the environment variables.
+// The environment variables override the file. If the path is empty, only the environment variables are used.
+// All errors in the file and the config are reported at once.
+func Load(path string) (Config, error) {
+	var errs ValidationError
+
+	// NOTE: env has the defaults and the environment variables
+	env := Config{}
+	envErr := envconfig.Process(envPrefix, &env)
+	if envErr != nil {
+		errs = append(errs, envErr.Error())
+	}
+
+	config := env
+	if path != "" {
+		if err := readFile(path, &config); err != nil {
+			if e, ok := err.(ValidationError); ok {
+				errs = append(errs, e...)
+			} else {
+				return Config{}, err
+			}
+		}
+		// NOTE: the file overrides the environment variables too, so they are set again
+		overlayEnv(reflect.ValueOf(&config).Elem(), reflect.ValueOf(env), strings.ToUpper(envPrefix))
+	}
+	config.setDefaults()
+
+	// NOTE: envconfig stops at the invalid variable, so the rest of the config would be reported as invalid
+	if envErr == nil {
+		if err := config.Validate(); err != nil {
+			errs = append(errs, err.(ValidationError)...)
+		}
+	}
+	if len(errs) != 0 {
+		return config, errs
+	}
+	return config, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.AccessLog.Out == "" {
+		c.AccessLog.Out = "stdout"
+	}
+	if c.ErrorLog.Out == "" {
+		c.ErrorLog.Out = "stderr"
+	}
+	if c.AccessLog.Level == "" {
+		c.AccessLog.Level = "debug"
+	}
+	if c.ErrorLog.Level == "" {
+		c.ErrorLog.Level = "debug"
+	}
+}
+
+// readFile decodes the config file into the config. The values which aren't in the file are kept.
+// NOTE: TOML isn't supported
+func readFile(path string, config *Config) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("unknown config file type: %s", ext)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read config file: %s", path)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return errors.Wrapf(err, "failed to parse config file: %s", path)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("config file must be a mapping: %s", path)
+	}
+
+	var errs ValidationError
+	decodeFile(doc.Content[0], reflect.ValueOf(config).Elem(), "", &errs)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isLeaf reports whether the type is decoded from a single value.
+func isLeaf(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// envKey returns the name of the environment variable of the field in the same way as envconfig.
+func envKey(prefix string, f reflect.StructField) string {
+	key := f.Name
+	if tag := f.Tag.Get("envconfig"); tag != "" {
+		key = tag
+	}
+	return strings.ToUpper(prefix + "_" + key)
+}
+
+func normalizeKey(key string) string {
+	key = strings.Replace(key, "_", "", -1)
+	key = strings.Replace(key, "-", "", -1)
+	return strings.ToLower(key)
+}
+
+// findField finds the field by the name in camelCase or snake_case, or the envconfig tag.
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	key = normalizeKey(key)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if normalizeKey(f.Name) == key || normalizeKey(f.Tag.Get("envconfig")) == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func decodeFile(n *yaml.Node, v reflect.Value, path string, errs *ValidationError) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, value := n.Content[i].Value, n.Content[i+1]
+		p := strings.TrimPrefix(path+"."+k, ".")
+		f, ok := findField(v.Type(), k)
+		if !ok {
+			*errs = append(*errs, "unknown key: "+p)
+			continue
+		}
+
+		if !isLeaf(f.Type) {
+			if value.Kind != yaml.MappingNode {
+				*errs = append(*errs, p+" must be a mapping")
+				continue
+			}
+			decodeFile(value, v.FieldByIndex(f.Index), p, errs)
+			continue
+		}
+
+		// NOTE: empty values are ignored, so that the defaults are applied
+		if value.Tag == "!!null" || (value.Kind == yaml.ScalarNode && value.Value == "") || (value.Kind == yaml.SequenceNode && len(value.Content) == 0) {
+			continue
+		}
+		if value.Kind == yaml.MappingNode {
+			*errs = append(*errs, p+" must be a scalar")
+			continue
+		}
+		if err := value.Decode(v.FieldByIndex(f.Index).Addr().Interface()); err != nil {
+			if e, ok := err.(*yaml.TypeError); ok {
+				err = errors.New(strings.Join(e.Errors, ", "))
+			}
+			*errs = append(*errs, fmt.Sprintf("invalid %s: %v", p, err))
+		}
+	}
+}
+
+// overlayEnv sets the fields of the environment variables which are set from src to dst.
+func overlayEnv(dst, src reflect.Value, prefix string) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := envKey(prefix, f)
+		if !isLeaf(f.Type) {
+			overlayEnv(dst.Field(i), src.Field(i), key)
+			continue
+		}
+		_, ok := os.LookupEnv(key)
+		// NOTE: envconfig also looks up the tag without the prefix, ex) HEARTBEAT_INTERVAL
+		if tag := f.Tag.Get("envconfig"); !ok && tag != "" {
+			_, ok = os.LookupEnv(strings.ToUpper(tag))
+		}
+		if ok {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// Dump writes the config as YAML in the format of the config file.
+// NOTE: secrets are written as REDACTED, so they have to be set again to load the output
+func Dump(w io.Writer, config Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(toNode(reflect.ValueOf(config))); err != nil {
+		return errors.Wrap(err, "failed to encode config")
+	}
+	return enc.Close()
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType      = reflect.TypeOf(time.Duration(0))
+)
+
+func toNode(v reflect.Value) *yaml.Node {
+	t := v.Type()
+	switch {
+	case t.Implements(textMarshalerType):
+		b, _ := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(b)}
+	case t == durationType:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: time.Duration(v.Int()).String()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: lowerCamel(f.Name)}, toNode(v.Field(i)))
+		}
+		return n
+	case reflect.Slice:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			n.Content = append(n.Content, toNode(v.Index(i)))
+		}
+		return n
+	case reflect.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v.Bool())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v.Int(), 10)}
+	case reflect.Float32, reflect.Float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(v.Float(), 'g', -1, 64)}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(v.Interface())}
+	}
+}
+
+// lowerCamel converts a field name to lowerCamelCase, ex) TLS -> tls, JWKSFile -> jwksFile
+func lowerCamel(s string) string {
+	r := []rune(s)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
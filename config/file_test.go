@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "plasma-config")
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, "plasma.yaml", `
+port: "8081"
+accessLog:
+  out: discard
+errorLog:
+  tee: ["stdout:info:console", /var/log/plasma/error.log]
+  rotate:
+    maxSize: 100
+    maxBackups: 3
+subscriber:
+  type: redis
+  redis:
+    addr: redis:6379
+    password: secret
+    channels: [plasma, "plasma,legacy"]
+    maxRetry: 3
+    timeout: 3s
+    over_max_retry_behavior: alive
+    retryInterval: 1s
+cors:
+  allowed_origins:
+    - https://*.example.com
+metrics:
+  event_type:
+    max: 10
+limit:
+  connectRate: 0.5
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Setenv("PLASMA_SUBSCRIBER_REDIS_ADDR", "localhost:6380")
+	defer os.Unsetenv("PLASMA_SUBSCRIBER_REDIS_ADDR")
+	os.Setenv("PLASMA_SUBSCRIBER_REDIS_MAXRETRY", "7")
+	defer os.Unsetenv("PLASMA_SUBSCRIBER_REDIS_MAXRETRY")
+
+	config, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal("8081", config.Port)
+	assert.Equal("discard", config.AccessLog.Out)
+	assert.Equal("debug", config.AccessLog.Level)
+	assert.Equal(LogSinks{
+		{Out: "stdout", Level: "info", Encoding: "console"},
+		{Out: "/var/log/plasma/error.log"},
+	}, config.ErrorLog.Tee)
+	assert.Equal(Rotate{MaxSize: 100, MaxBackups: 3}, config.ErrorLog.Rotate)
+	assert.Equal("redis", config.Subscriber.Type)
+	// NOTE: the environment variables override the file
+	assert.Equal("localhost:6380", config.Subscriber.Redis.Addr)
+	assert.Equal("secret", config.Subscriber.Redis.Password.Value())
+	// NOTE: items of lists aren't split by comma
+	assert.Equal(Channels{"plasma", "plasma,legacy"}, config.Subscriber.Redis.Channels)
+	assert.Equal(7, config.Subscriber.Redis.MaxRetry)
+	assert.Equal(3*time.Second, config.Subscriber.Redis.Timeout)
+	assert.Equal(OverMaxRetryBehaviorAlive, config.Subscriber.Redis.OverMaxRetryBehavior.Type)
+	assert.Equal(time.Second, config.Subscriber.Redis.RetryInterval)
+	assert.Equal([]string{"https://*.example.com"}, config.CORS.AllowedOrigins)
+	assert.Equal(10, config.Metrics.EventType.Max)
+	assert.Equal(0.5, config.Limit.ConnectRate)
+	// defaults
+	assert.Equal("50051", config.GrpcPort)
+
+	// the file isn't left in the environment
+	_, ok := os.LookupEnv("PLASMA_PORT")
+	assert.False(ok)
+}
+
+func TestLoadEnv(t *testing.T) {
+	os.Setenv("PLASMA_SUBSCRIBER_TYPE", "redis")
+	defer os.Unsetenv("PLASMA_SUBSCRIBER_TYPE")
+	os.Setenv("PLASMA_SUBSCRIBER_REDIS_CHANNELS", "plasma,plasma2")
+	defer os.Unsetenv("PLASMA_SUBSCRIBER_REDIS_CHANNELS")
+	os.Setenv("PLASMA_ERRORLOG_TEE", "stdout:info:console,/var/log/plasma/error.log")
+	defer os.Unsetenv("PLASMA_ERRORLOG_TEE")
+
+	// NOTE: only the environment variables are processed by envconfig as before
+	expect := Config{}
+	require.NoError(t, envconfig.Process(envPrefix, &expect))
+	expect.setDefaults()
+
+	config, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, expect, config)
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeConfigFile(t, "plasma.yml", `
+port: "http"
+debug: true
+subscriber:
+  type: kafka
+  redis:
+    unknown: true
+metrics:
+  type: datadog
+tls: cert.pem
+cluster:
+  type: redis
+  interval: 10s
+  ttl: 5s
+limit:
+  connectRate: fast
+cors:
+  allowedOrigins: ["*"]
+  allowCredentials: true
+trustedProxies: [10.0.0.0/8, proxy]
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := Load(path)
+	require.Error(t, err)
+	errs, ok := err.(ValidationError)
+	require.True(t, ok, err.Error())
+
+	actual := []string(errs)
+	sort.Strings(actual)
+	assert.Equal(t, []string{
+		`CORS allowed origins must not contain "*" with credentials`,
+		"cluster TTL must be longer than the interval: 5s",
+		"invalid limit.connectRate: line 16: cannot unmarshal !!str `fast` into float64",
+		`invalid port: "http"`,
+		`invalid trusted proxy: "proxy"`,
+		"redis channels are required for the debug endpoint",
+		"tls must be a mapping",
+		"unknown key: subscriber.redis.unknown",
+		`unknown metrics type: "datadog"`,
+		`unknown subscriber type: "kafka"`,
+	}, actual)
+
+	// NOTE: the rest of the environment variables aren't processed, so the config isn't validated
+	os.Setenv("PLASMA_SUBSCRIBER_REDIS_MAXRETRY", "many")
+	defer os.Unsetenv("PLASMA_SUBSCRIBER_REDIS_MAXRETRY")
+	_, err = Load(path)
+	require.Error(t, err)
+	errs, ok = err.(ValidationError)
+	require.True(t, ok, err.Error())
+	actual = []string(errs)
+	sort.Strings(actual)
+	assert.Equal(t, []string{
+		"envconfig.Process: assigning PLASMA_SUBSCRIBER_REDIS_MAXRETRY to MaxRetry: converting 'many' to type int. details: strconv.ParseInt: parsing \"many\": invalid syntax",
+		"invalid limit.connectRate: line 16: cannot unmarshal !!str `fast` into float64",
+		"tls must be a mapping",
+		"unknown key: subscriber.redis.unknown",
+	}, actual)
+
+	// NOTE: TOML isn't supported
+	_, err = Load(writeConfigFile(t, "plasma.toml", ""))
+	assert.EqualError(t, err, "unknown config file type: .toml")
+}
+
+func TestDump(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, "plasma.yaml", `
+subscriber:
+  type: redis
+  redis:
+    password: secret
+    channels: [plasma]
+    overMaxRetryBehavior: die
+tls:
+  clientAuth: require
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := Load(path)
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, Dump(&b, config))
+	assert.Contains(b.String(), "password: "+redacted)
+	assert.NotContains(b.String(), "password: secret")
+	assert.Contains(b.String(), "clientAuth: require")
+	assert.Contains(b.String(), "retryInterval: 5s")
+
+	// NOTE: the dumped config can be loaded again
+	dumped := writeConfigFile(t, "dumped.yaml", b.String())
+	defer os.RemoveAll(filepath.Dir(dumped))
+	reloaded, err := Load(dumped)
+	require.NoError(t, err)
+	reloaded.Subscriber.Redis.Password = config.Subscriber.Redis.Password
+	assert.Equal(config, reloaded)
+}
+
+func TestLowerCamel(t *testing.T) {
+	cases := []struct {
+		name   string
+		expect string
+	}{
+		{name: "Port", expect: "port"},
+		{name: "TLS", expect: "tls"},
+		{name: "DB", expect: "db"},
+		{name: "JWKSFile", expect: "jwksFile"},
+		{name: "ClientCAFile", expect: "clientCAFile"},
+		{name: "MaxConnectionsSSE", expect: "maxConnectionsSSE"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, lowerCamel(c.name))
+	}
+}
+
+func TestLogSinks(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		text   string
+		expect LogSinks
+		err    bool
+	}{
+		{text: "", expect: nil},
+		{text: "stdout", expect: LogSinks{{Out: "stdout"}}},
+		{
+			text: "stdout:info:console,/var/log/plasma/error.log",
+			expect: LogSinks{
+				{Out: "stdout", Level: "info", Encoding: "console"},
+				{Out: "/var/log/plasma/error.log"},
+			},
+		},
+		{text: ":info", err: true},
+		{text: "stdout:info:console:x", err: true},
+	}
+
+	for _, c := range cases {
+		var sinks LogSinks
+		err := sinks.UnmarshalText([]byte(c.text))
+		if c.err {
+			assert.Error(err, c.text)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(c.expect, sinks)
+
+		b, err := sinks.MarshalText()
+		require.NoError(t, err)
+		assert.Equal(c.text, string(b))
+	}
+}
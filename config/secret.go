@@ -0,0 +1,29 @@
+package config
+
+// Secret is a credential in the config. It is redacted when it is logged, printed or marshaled,
+// so use Value only to pass it to the client which needs it.
+type Secret string
+
+const redacted = "REDACTED"
+
+// Value returns the secret in plain text. Never log it.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns "REDACTED" unless the secret is empty, so that it can be seen whether the secret is set.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalText redacts the secret in JSON, YAML and zap fields.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
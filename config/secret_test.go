@@ -0,0 +1,28 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Secret("password")
+	assert.Equal("password", s.Value())
+
+	for _, format := range []string{"%s", "%v", "%+v", "%#v", "%q"} {
+		assert.NotContains(fmt.Sprintf(format, s), "password", format)
+		assert.NotContains(fmt.Sprintf(format, Redis{Password: s}), "password", format)
+	}
+
+	b, err := json.Marshal(Config{Subscriber: Subscriber{Redis: Redis{Password: s}}})
+	assert.NoError(err)
+	assert.Contains(string(b), `"Password":"REDACTED"`)
+
+	// NOTE: an empty secret is shown as empty to tell that it isn't set
+	assert.Equal("", Secret("").String())
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ValidationError reports all errors of the config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config:\n- " + strings.Join(e, "\n- ")
+}
+
+// NOTE: the types are defined in the packages which use them, but they can't be imported here
+var (
+	subscriberTypes    = []string{"mock", "redis"}
+	metricsTypes       = []string{"", "log", "syslog", "statsd"}
+	logEncodings       = []string{"", "json", "console"}
+	authTypes          = []string{"", "jwt"}
+	authorizationTypes = []string{"", "claims"}
+	clusterTypes       = []string{"", "redis"}
+)
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) oneOf(name, value string, values []string) {
+	if !contains(values, value) {
+		v.errorf("unknown %s: %q", name, value)
+	}
+}
+
+func (v *validator) port(name, value string) {
+	if p, err := strconv.Atoi(value); err != nil || p < 0 || 65535 < p {
+		v.errorf("invalid %s: %q", name, value)
+	}
+}
+
+func (v *validator) notNegative(name string, value int64) {
+	if value < 0 {
+		v.errorf("%s must not be negative: %d", name, value)
+	}
+}
+
+func (v *validator) positive(name string, value int64) {
+	if value <= 0 {
+		v.errorf("%s must be positive: %d", name, value)
+	}
+}
+
+func (v *validator) logLevel(name, value string) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		v.errorf("unknown %s level: %q", name, value)
+	}
+}
+
+func (v *validator) log(name string, l Log) {
+	v.logLevel(name, l.Level)
+	v.oneOf(name+" encoding", l.Encoding, logEncodings)
+	for _, s := range l.Tee {
+		if s.Level != "" {
+			v.logLevel(name+" tee", s.Level)
+		}
+		v.oneOf(name+" tee encoding", s.Encoding, logEncodings)
+	}
+	v.rotate(name, l.Rotate)
+	v.notNegative(name+" sampling initial", int64(l.Sampling.Initial))
+	v.notNegative(name+" sampling thereafter", int64(l.Sampling.Thereafter))
+	if l.Sampling.Initial > 0 {
+		v.positive(name+" sampling tick", int64(l.Sampling.Tick))
+	}
+}
+
+func (v *validator) rotate(name string, r Rotate) {
+	v.notNegative(name+" rotate max size", int64(r.MaxSize))
+	v.notNegative(name+" rotate interval", int64(r.Interval))
+	v.notNegative(name+" rotate max backups", int64(r.MaxBackups))
+	v.notNegative(name+" rotate max age", int64(r.MaxAge))
+}
+
+// Validate checks the whole config and reports all errors at once.
+func (c Config) Validate() error {
+	v := &validator{}
+
+	v.log("access log", c.AccessLog)
+	v.log("error log", c.ErrorLog)
+	v.port("port", c.Port)
+	v.port("gRPC port", c.GrpcPort)
+	v.port("metrics port", c.MerticsPort)
+	v.positive("SSE retry", int64(c.SSE.Retry))
+	v.positive("SSE heartbeat interval", int64(c.SSE.HeartbeatInterval))
+	if c.SSE.EventQuery == "" {
+		v.errorf("SSE event query is required")
+	}
+
+	for _, p := range c.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				v.errorf("invalid trusted proxy: %q", p)
+			}
+		}
+	}
+
+	// NOTE: browsers reject credentials with "*", and echoing any origin with credentials is unsafe
+	if c.CORS.AllowCredentials && (contains(c.CORS.AllowedOrigins, "*") || c.Origin == "*") {
+		v.errorf(`CORS allowed origins must not contain "*" with credentials`)
+	}
+
+	v.oneOf("subscriber type", c.Subscriber.Type, subscriberTypes)
+	if c.Subscriber.Type == "redis" {
+		v.oneOf("redis mode", c.Subscriber.Redis.Mode, []string{RedisModeStatic, RedisModeInterest})
+		// NOTE: the interest mode can run without static channels
+		if len(c.Subscriber.Redis.Channels) == 0 && c.Subscriber.Redis.Mode != RedisModeInterest {
+			v.errorf("redis channels are required for the redis subscriber")
+		}
+		v.positive("redis max retry", int64(c.Subscriber.Redis.MaxRetry))
+	}
+	if c.Subscriber.Type == "mock" {
+		v.positive("mock interval", int64(c.Subscriber.Mock.Interval))
+	}
+	// NOTE: the debug endpoint publishes to the first channel
+	if c.Debug && len(c.Subscriber.Redis.Channels) == 0 {
+		v.errorf("redis channels are required for the debug endpoint")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		v.errorf("both TLS cert file and key file are required")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		v.errorf("TLS client CA file requires TLS cert file and key file")
+	}
+
+	v.oneOf("metrics type", c.Metrics.Type, metricsTypes)
+	if c.Metrics.Type != "" {
+		v.positive("metrics interval", int64(c.Metrics.Interval))
+	}
+	v.rotate("metrics log", c.Metrics.Log.Rotate)
+	v.notNegative("metrics event type max", int64(c.Metrics.EventType.Max))
+	v.notNegative("metrics event type depth", int64(c.Metrics.EventType.Depth))
+
+	v.oneOf("auth type", c.Auth.Type, authTypes)
+	if c.Auth.Type == "jwt" && c.Auth.JWT.SecretFile == "" && c.Auth.JWT.PublicKeyFile == "" && c.Auth.JWT.JWKSFile == "" {
+		v.errorf("one of JWT secret file, public key file or JWKS file is required for the jwt auth")
+	}
+	v.oneOf("authorization type", c.Auth.Authorization.Type, authorizationTypes)
+
+	v.notNegative("max connections", int64(c.Limit.MaxConnections))
+	v.notNegative("max connections of SSE", int64(c.Limit.MaxConnectionsSSE))
+	v.notNegative("max connections of gRPC", int64(c.Limit.MaxConnectionsGRPC))
+	v.notNegative("max connections per address", int64(c.Limit.MaxConnectionsPerAddr))
+	if c.Limit.ConnectRate < 0 {
+		v.errorf("connect rate must not be negative: %g", c.Limit.ConnectRate)
+	}
+
+	v.positive("max events", int64(c.Subscription.MaxEvents))
+	v.positive("max event length", int64(c.Subscription.MaxEventLength))
+	v.positive("max depth", int64(c.Subscription.MaxDepth))
+	if c.Subscription.AllowedChars == "" {
+		v.errorf("allowed chars of event types are required")
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if c.Tracing.SampleRate < 0 || 1 < c.Tracing.SampleRate {
+			v.errorf("tracing sample rate must be between 0 and 1: %g", c.Tracing.SampleRate)
+		}
+		v.positive("tracing batch size", int64(c.Tracing.BatchSize))
+		v.positive("tracing interval", int64(c.Tracing.Interval))
+	}
+
+	v.notNegative("drain timeout", int64(c.Drain.Timeout))
+	v.notNegative("drain waves", int64(c.Drain.Waves))
+	v.notNegative("drain interval", int64(c.Drain.Interval))
+	v.positive("health fan-out timeout", int64(c.Health.FanOutTimeout))
+
+	v.oneOf("cluster type", c.Cluster.Type, clusterTypes)
+	if c.Cluster.Type != "" {
+		v.positive("cluster interval", int64(c.Cluster.Interval))
+		// NOTE: a record must outlive the interval, or live nodes disappear between heartbeats
+		if c.Cluster.TTL <= c.Cluster.Interval {
+			v.errorf("cluster TTL must be longer than the interval: %s", c.Cluster.TTL)
+		}
+		if c.Cluster.KeyPrefix == "" {
+			v.errorf("cluster key prefix is required")
+		}
+	}
+
+	if len(c.Presence.EventTypes) != 0 {
+		v.positive("presence interval", int64(c.Presence.Interval))
+		for _, e := range c.Presence.EventTypes {
+			// NOTE: presence of presence would publish forever
+			if e == "" || e == "presence" || strings.HasPrefix(e, "presence:") {
+				v.errorf("invalid presence event type: %q", e)
+			}
+		}
+	}
+
+	if len(v.errs) != 0 {
+		return v.errs
+	}
+	return nil
+}
@@ -2,17 +2,43 @@ package event
 
 import (
 	"encoding/json"
+	"time"
 
 	"go.uber.org/zap/zapcore"
 )
 
 type MetaData struct {
 	Type string `json:"type"`
+	// PublishedAt is unix time in milliseconds stamped by the publisher
+	PublishedAt int64 `json:"publishedAt,omitempty"`
+	// Traceparent is the W3C trace context to trace the delivery
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// PublishedTime returns the zero time if the publisher doesn't stamp publishedAt.
+func (m MetaData) PublishedTime() time.Time {
+	if m.PublishedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, m.PublishedAt*int64(time.Millisecond))
 }
 
 type Payload struct {
 	Meta MetaData        `json:"meta"`
 	Data json.RawMessage `json:"data"`
+	// NOTE: the following times are used to measure the delivery latency, and aren't sent to clients
+	ReceivedAt time.Time `json:"-"`
+	EnqueuedAt time.Time `json:"-"`
+	// Encoded is set at fan-out time, and shared by the writers of all clients
+	Encoded *Encoded `json:"-"`
+}
+
+// Encoded is the payload serialized once for the transport. It must not be modified because it is read concurrently.
+type Encoded struct {
+	// SSE is the data field of the SSE frame, ex) data: {"meta":{"type":"program:1234"},"data":{}}\n\n
+	SSE []byte
+	// Proto is the payload encoded in protocol buffers for gRPC streams.
+	Proto []byte
 }
 
 func (p Payload) MarshalLogObject(enc zapcore.ObjectEncoder) error {
@@ -0,0 +1,72 @@
+package event
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+const separator = ":"
+
+// Validator validates event types requested by a client.
+// A zero value of each limit means unlimited.
+type Validator struct {
+	maxEvents      int
+	maxEventLength int
+	maxDepth       int
+	segment        *regexp.Regexp
+}
+
+func NewValidator(config config.Subscription) (*Validator, error) {
+	v := &Validator{
+		maxEvents:      config.MaxEvents,
+		maxEventLength: config.MaxEventLength,
+		maxDepth:       config.MaxDepth,
+	}
+	if config.AllowedChars != "" {
+		segment, err := regexp.Compile("^[" + config.AllowedChars + "]+$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid allowed chars: %s", config.AllowedChars)
+		}
+		v.segment = segment
+	}
+	return v, nil
+}
+
+// Validate returns an error which describes the first invalid event type.
+func (v *Validator) Validate(events []string) error {
+	if v.maxEvents > 0 && len(events) > v.maxEvents {
+		return fmt.Errorf("too many event types: %d (max %d)", len(events), v.maxEvents)
+	}
+	for _, e := range events {
+		if err := v.validate(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validate(e string) error {
+	if e == "" {
+		return errors.New("event type can't be empty")
+	}
+	if v.maxEventLength > 0 && len(e) > v.maxEventLength {
+		return fmt.Errorf("event type is too long: %d bytes (max %d)", len(e), v.maxEventLength)
+	}
+	segments := strings.Split(e, separator)
+	if v.maxDepth > 0 && len(segments) > v.maxDepth {
+		return fmt.Errorf("event type has too many segments: %s (max %d)", e, v.maxDepth)
+	}
+	for _, s := range segments {
+		if s == "" {
+			return fmt.Errorf("event type has an empty segment: %s", e)
+		}
+		if v.segment != nil && !v.segment.MatchString(s) {
+			return fmt.Errorf("event type has invalid characters: %s", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package event
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := NewValidator(config.Subscription{
+		MaxEvents:      3,
+		MaxEventLength: 20,
+		MaxDepth:       3,
+		AllowedChars:   "A-Za-z0-9_.-",
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		events []string
+		isErr  bool
+	}{
+		{events: []string{"program"}},
+		{events: []string{"program:1234:views", "program:1234:poll", "user_1.a-b"}},
+		{events: []string{"a", "b", "c", "d"}, isErr: true},
+		{events: []string{""}, isErr: true},
+		{events: []string{strings.Repeat("a", 21)}, isErr: true},
+		{events: []string{"a:b:c:d"}, isErr: true},
+		{events: []string{"program::views"}, isErr: true},
+		{events: []string{"program:"}, isErr: true},
+		{events: []string{"program:<script>"}, isErr: true},
+		{events: []string{"program 1"}, isErr: true},
+		{events: []string{"program", "program*"}, isErr: true},
+	}
+
+	for _, c := range cases {
+		err := v.Validate(c.events)
+		if c.isErr {
+			assert.Error(err, "%v", c.events)
+		} else {
+			assert.NoError(err, "%v", c.events)
+		}
+	}
+}
+
+func TestValidateUnlimited(t *testing.T) {
+	v, err := NewValidator(config.Subscription{})
+	require.NoError(t, err)
+
+	events := make([]string, 1000)
+	for i := range events {
+		events[i] = strings.Repeat("あ:", 20) + "a"
+	}
+	assert.NoError(t, v.Validate(events))
+	assert.Error(t, v.Validate([]string{""}))
+}
+
+func TestNewValidatorInvalidChars(t *testing.T) {
+	_, err := NewValidator(config.Subscription{AllowedChars: "z-a"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package limit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/metrics"
+)
+
+const (
+	SSE  = "sse"
+	GRPC = "grpc"
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrRateLimited        = errors.New("too many connect attempts")
+)
+
+// NOTE: buckets which are full are removed when the number of buckets exceeds this,
+// and buckets idle longer than the refill window are removed every window.
+// New addresses are rejected if all of the buckets are still in use
+const maxBuckets = 10000
+
+// Limiter limits connections globally, per transport and per remote address,
+// and limits connect attempts per remote address by token buckets.
+// A zero value of each limit means unlimited.
+type Limiter struct {
+	config     config.Limit
+	mu         sync.Mutex
+	total      int
+	transports map[string]int
+	addrs      map[string]int
+	buckets    map[string]*bucket
+	maxBuckets int
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+func New(config config.Limit) *Limiter {
+	return &Limiter{
+		config:     config,
+		transports: make(map[string]int),
+		addrs:      make(map[string]int),
+		buckets:    make(map[string]*bucket),
+		maxBuckets: maxBuckets,
+		now:        time.Now,
+	}
+}
+
+// SetConfig replaces the limits. Current connections are kept even if they exceed the new limits.
+func (l *Limiter) SetConfig(config config.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+	if config.ConnectRate <= 0 {
+		l.buckets = make(map[string]*bucket)
+	}
+}
+
+func (l *Limiter) maxConnections(transport string) int {
+	switch transport {
+	case SSE:
+		return l.config.MaxConnectionsSSE
+	case GRPC:
+		return l.config.MaxConnectionsGRPC
+	}
+	return 0
+}
+
+func exceeds(max, current int) bool {
+	return max > 0 && current >= max
+}
+
+// Acquire reserves a connection. Release must be called when the connection is closed if it returns no error.
+func (l *Limiter) Acquire(transport, addr string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.ConnectRate > 0 && !l.allow(addr) {
+		metrics.IncRateLimited()
+		return ErrRateLimited
+	}
+
+	if exceeds(l.config.MaxConnections, l.total) ||
+		exceeds(l.maxConnections(transport), l.transports[transport]) ||
+		exceeds(l.config.MaxConnectionsPerAddr, l.addrs[addr]) {
+		metrics.IncConnectionRejected()
+		return ErrTooManyConnections
+	}
+
+	l.total++
+	l.transports[transport]++
+	l.addrs[addr]++
+
+	return nil
+}
+
+func (l *Limiter) Release(transport, addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	l.transports[transport]--
+	if l.addrs[addr]--; l.addrs[addr] <= 0 {
+		delete(l.addrs, addr)
+	}
+}
+
+// Connections returns the number of the current connections.
+func (l *Limiter) Connections() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// Full reports whether the global connection limit is reached.
+func (l *Limiter) Full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return exceeds(l.config.MaxConnections, l.total)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *Limiter) allow(addr string) bool {
+	now := l.now()
+	burst := float64(l.config.ConnectBurst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	// NOTE: an empty bucket is refilled within the window
+	window := time.Duration(burst / l.config.ConnectRate * float64(time.Second))
+	if now.Sub(l.lastSweep) >= window {
+		l.sweep(now, burst)
+	}
+
+	b, ok := l.buckets[addr]
+	if !ok {
+		if len(l.buckets) >= l.maxBuckets {
+			l.sweep(now, burst)
+		}
+		// NOTE: evicting the others would let many addresses reset the buckets in use
+		if len(l.buckets) >= l.maxBuckets {
+			return false
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[addr] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.config.ConnectRate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep removes the buckets which are full by now, including the buckets idle longer than the refill window.
+func (l *Limiter) sweep(now time.Time, burst float64) {
+	l.lastSweep = now
+	for addr, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.config.ConnectRate >= burst {
+			delete(l.buckets, addr)
+		}
+	}
+}
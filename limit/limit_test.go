@@ -0,0 +1,186 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	type acquire struct {
+		transport string
+		addr      string
+		err       error
+	}
+
+	cases := []struct {
+		config   config.Limit
+		acquires []acquire
+	}{
+		{
+			config: config.Limit{},
+			acquires: []acquire{
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: GRPC, addr: "10.0.0.1"},
+			},
+		},
+		{
+			config: config.Limit{MaxConnections: 2},
+			acquires: []acquire{
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: GRPC, addr: "10.0.0.2"},
+				{transport: SSE, addr: "10.0.0.3", err: ErrTooManyConnections},
+			},
+		},
+		{
+			config: config.Limit{MaxConnectionsSSE: 1},
+			acquires: []acquire{
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: SSE, addr: "10.0.0.2", err: ErrTooManyConnections},
+				{transport: GRPC, addr: "10.0.0.2"},
+			},
+		},
+		{
+			config: config.Limit{MaxConnectionsGRPC: 1},
+			acquires: []acquire{
+				{transport: GRPC, addr: "10.0.0.1"},
+				{transport: GRPC, addr: "10.0.0.2", err: ErrTooManyConnections},
+				{transport: SSE, addr: "10.0.0.2"},
+			},
+		},
+		{
+			config: config.Limit{MaxConnectionsPerAddr: 1},
+			acquires: []acquire{
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: GRPC, addr: "10.0.0.1", err: ErrTooManyConnections},
+				{transport: SSE, addr: "10.0.0.2"},
+			},
+		},
+		{
+			config: config.Limit{ConnectRate: 1, ConnectBurst: 2},
+			acquires: []acquire{
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: SSE, addr: "10.0.0.1"},
+				{transport: SSE, addr: "10.0.0.1", err: ErrRateLimited},
+				{transport: SSE, addr: "10.0.0.2"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		l := New(c.config)
+		now := time.Unix(0, 0)
+		l.now = func() time.Time { return now }
+
+		for _, a := range c.acquires {
+			assert.Equal(t, a.err, l.Acquire(a.transport, a.addr))
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(config.Limit{MaxConnections: 1, MaxConnectionsPerAddr: 1})
+
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	assert.Equal(ErrTooManyConnections, l.Acquire(SSE, "10.0.0.1"))
+	assert.Equal(1, l.Connections())
+	assert.True(l.Full())
+
+	l.Release(SSE, "10.0.0.1")
+	assert.Equal(0, l.Connections())
+	assert.False(l.Full())
+	assert.Empty(l.addrs)
+
+	assert.NoError(l.Acquire(GRPC, "10.0.0.1"))
+}
+
+func TestSetConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(config.Limit{MaxConnections: 1})
+
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	assert.Equal(ErrTooManyConnections, l.Acquire(GRPC, "10.0.0.2"))
+
+	l.SetConfig(config.Limit{MaxConnections: 2})
+	assert.NoError(l.Acquire(GRPC, "10.0.0.2"))
+	assert.Equal(2, l.Connections())
+
+	// NOTE: current connections are kept when the limit is lowered
+	l.SetConfig(config.Limit{MaxConnections: 1})
+	assert.Equal(2, l.Connections())
+	assert.Equal(ErrTooManyConnections, l.Acquire(SSE, "10.0.0.3"))
+}
+
+func TestConnectRate(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(config.Limit{ConnectRate: 2, ConnectBurst: 1})
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	assert.Equal(ErrRateLimited, l.Acquire(SSE, "10.0.0.1"))
+
+	// a token is refilled every 500ms
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(ErrRateLimited, l.Acquire(SSE, "10.0.0.1"))
+	now = now.Add(250 * time.Millisecond)
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+
+	// tokens never exceed the burst
+	now = now.Add(time.Minute)
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	assert.Equal(ErrRateLimited, l.Acquire(SSE, "10.0.0.1"))
+}
+
+func TestSweepIdleBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(config.Limit{ConnectRate: 2, ConnectBurst: 4})
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	now = now.Add(time.Second)
+	for i := 0; i < 4; i++ {
+		assert.NoError(l.Acquire(SSE, "10.0.0.2"))
+	}
+	assert.Len(l.buckets, 2)
+
+	// the refill window is 2s, so only the bucket of 10.0.0.1 is full
+	now = now.Add(time.Second)
+	assert.NoError(l.Acquire(SSE, "10.0.0.3"))
+	assert.Len(l.buckets, 2)
+	assert.NotContains(l.buckets, "10.0.0.1")
+
+	// buckets are dropped when the rate limit is disabled
+	l.SetConfig(config.Limit{})
+	assert.Len(l.buckets, 0)
+}
+
+func TestMaxBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(config.Limit{ConnectRate: 1, ConnectBurst: 2})
+	l.maxBuckets = 2
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	assert.NoError(l.Acquire(SSE, "10.0.0.1"))
+	assert.NoError(l.Acquire(SSE, "10.0.0.2"))
+	// the buckets are in use, so a new address is rejected
+	assert.Equal(ErrRateLimited, l.Acquire(SSE, "10.0.0.3"))
+	assert.Len(l.buckets, 2)
+
+	// the bucket of 10.0.0.1 is refilled and removed
+	now = now.Add(time.Second)
+	assert.NoError(l.Acquire(SSE, "10.0.0.2"))
+	assert.NoError(l.Acquire(SSE, "10.0.0.3"))
+	assert.Len(l.buckets, 2)
+}
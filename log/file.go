@@ -0,0 +1,214 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	megabyte         = 1024 * 1024
+	backupTimeFormat = "20060102T150405.000"
+)
+
+// File is a log file which is rotated by size or time, and can be reopened after it is moved by logrotate.
+type File struct {
+	mu       sync.Mutex
+	path     string
+	config   config.Rotate
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+var files = struct {
+	mu sync.Mutex
+	m  map[*File]struct{}
+}{m: make(map[*File]struct{})}
+
+// OpenFile opens the file in append mode. The file is reopened by Reopen until it is closed.
+func OpenFile(path string, config config.Rotate) (*File, error) {
+	f := &File{
+		path:   path,
+		config: config,
+		now:    time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	files.mu.Lock()
+	files.m[f] = struct{}{}
+	files.mu.Unlock()
+	return f, nil
+}
+
+// Reopen reopens all open files. Call it after logrotate moves the files, ex) on SIGUSR1
+func Reopen() error {
+	files.mu.Lock()
+	defer files.mu.Unlock()
+	var err error
+	for f := range files.m {
+		if e := f.Reopen(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: %s", f.path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "failed to stat file: %s", f.path)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(len(p)) {
+		// NOTE: keep writing to the file even if the backups can't be moved or removed
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if max := int64(f.config.MaxSize) * megabyte; max > 0 && f.size+int64(n) > max {
+		return true
+	}
+	return f.config.Interval > 0 && f.now().Sub(f.openedAt) >= f.config.Interval
+}
+
+func (f *File) backupPrefix() (string, string) {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-", ext
+}
+
+// rotate moves the file to the backup with the current time, ex) error-20170701T120000.000.log
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close file: %s", f.path)
+	}
+	f.file = nil
+	prefix, ext := f.backupPrefix()
+	renameErr := os.Rename(f.path, prefix+f.now().Format(backupTimeFormat)+ext)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return errors.Wrapf(renameErr, "failed to rotate file: %s", f.path)
+	}
+	return f.removeBackups()
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups returns the backups from newest to oldest.
+func (f *File) backups() ([]backup, error) {
+	prefix, ext := f.backupPrefix()
+	paths, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, p := range paths {
+		// NOTE: the time of the name is in local time
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(p, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: p, time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+	return backups, nil
+}
+
+func (f *File) removeBackups() error {
+	if f.config.MaxBackups <= 0 && f.config.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return errors.Wrapf(err, "failed to list backups: %s", f.path)
+	}
+	for i, b := range backups {
+		if (f.config.MaxBackups > 0 && i >= f.config.MaxBackups) ||
+			(f.config.MaxAge > 0 && f.now().Sub(b.time) > f.config.MaxAge) {
+			if err := os.Remove(b.path); err != nil {
+				return errors.Wrapf(err, "failed to remove backup: %s", b.path)
+			}
+		}
+	}
+	return nil
+}
+
+// Reopen closes the file and opens the path again.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close file: %s", f.path)
+	}
+	f.file = nil
+	return f.open()
+}
+
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	files.mu.Lock()
+	delete(files.m, f)
+	files.mu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempLogPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "plasma-log")
+	require.NoError(t, err)
+	return filepath.Join(dir, "plasma.log")
+}
+
+func backupPaths(t *testing.T, f *File) []string {
+	backups, err := f.backups()
+	require.NoError(t, err)
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = filepath.Base(b.path)
+	}
+	return paths
+}
+
+func TestFileRotateBySize(t *testing.T) {
+	assert := assert.New(t)
+
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	f, err := OpenFile(path, config.Rotate{MaxSize: 1, MaxBackups: 2})
+	require.NoError(t, err)
+	defer f.Close()
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	line := make([]byte, megabyte/2)
+	for i := 0; i < 8; i++ {
+		_, err := f.Write(line)
+		require.NoError(t, err)
+		now = now.Add(time.Second)
+	}
+
+	// NOTE: 2 lines in each file, and the oldest backup is removed
+	assert.Equal([]string{"plasma-20170701T120006.000.log", "plasma-20170701T120004.000.log"}, backupPaths(t, f))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(int64(megabyte), info.Size())
+}
+
+func TestFileRotateByInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	f, err := OpenFile(path, config.Rotate{Interval: time.Hour, MaxAge: 90 * time.Minute})
+	require.NoError(t, err)
+	defer f.Close()
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+
+	write := func() {
+		_, err := f.Write([]byte("line\n"))
+		require.NoError(t, err)
+	}
+
+	write()
+	now = now.Add(30 * time.Minute)
+	write()
+	assert.Empty(backupPaths(t, f))
+
+	now = now.Add(30 * time.Minute)
+	write()
+	assert.Equal([]string{"plasma-20170701T130000.000.log"}, backupPaths(t, f))
+
+	now = now.Add(time.Hour)
+	write()
+	assert.Equal([]string{"plasma-20170701T140000.000.log", "plasma-20170701T130000.000.log"}, backupPaths(t, f))
+
+	// NOTE: backups older than MaxAge are removed
+	now = now.Add(time.Hour)
+	write()
+	assert.Equal([]string{"plasma-20170701T150000.000.log", "plasma-20170701T140000.000.log"}, backupPaths(t, f))
+}
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	f, err := OpenFile(path, config.Rotate{})
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// NOTE: logrotate moves the file and sends SIGUSR1
+	moved := path + ".1"
+	require.NoError(t, os.Rename(path, moved))
+	require.NoError(t, Reopen())
+
+	_, err = f.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile(moved)
+	require.NoError(t, err)
+	assert.Equal("before\n", string(b))
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal("after\n", string(b))
+
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("closed\n"))
+	assert.Error(err)
+	// NOTE: closed files aren't reopened
+	require.NoError(t, Reopen())
+}
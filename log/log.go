@@ -1,17 +1,26 @@
 package log
 
 import (
-	"io"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
 	"github.com/pkg/errors"
 
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -22,35 +31,140 @@ var (
 )
 
 func NewLogger(config config.Log) (*zap.Logger, error) {
-	var writer io.Writer
-	switch config.Out {
-	case "stdout":
-		writer = os.Stdout
-	case "stderr":
-		writer = os.Stderr
-	case "discard":
-		writer = ioutil.Discard
-	default:
-		w, err := os.OpenFile(config.Out, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	logger, _, err := NewLoggerWithLevel(config)
+	return logger, err
+}
+
+// NewLoggerWithLevel returns the logger and its level, which can be changed while running.
+// The logger writes to Out and every sink of Tee. Sinks without their own level follow the returned level.
+func NewLoggerWithLevel(c config.Log) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if err := SetLevel(level, c.Level); err != nil {
+		return nil, level, err
+	}
+
+	sinks := append([]config.LogSink{{Out: c.Out, Encoding: c.Encoding}}, c.Tee...)
+	cores := make([]zapcore.Core, len(sinks))
+	var errorOutput zapcore.WriteSyncer
+	var files []*File
+	// NOTE: close the files opened for the former sinks if a later sink fails
+	fail := func(err error) (*zap.Logger, zap.AtomicLevel, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, level, err
+	}
+	for i, sink := range sinks {
+		writer, file, err := newWriter(sink.Out, c.Rotate)
+		if err != nil {
+			return fail(err)
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+		if errorOutput == nil {
+			errorOutput = writer
+		}
+
+		var enabler zapcore.LevelEnabler = level
+		if sink.Level != "" {
+			var l zapcore.Level
+			if err := l.UnmarshalText([]byte(sink.Level)); err != nil {
+				return fail(errors.Wrapf(err, "failed to unmarshal level %s", sink.Level))
+			}
+			enabler = l
+		}
+
+		encoding := sink.Encoding
+		if encoding == "" {
+			encoding = c.Encoding
+		}
+		encoder, err := newEncoder(encoding)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to open file: %s", config.Out)
+			return fail(err)
 		}
-		writer = w
+
+		cores[i] = zapcore.NewCore(encoder, writer, enabler)
 	}
 
-	var level zapcore.Level
-	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
-		return nil, errors.Wrapf(err, "failed to unmarshal level %s", config.Level)
+	core := zapcore.NewTee(cores...)
+	if c.Sampling.Initial > 0 {
+		thereafter := c.Sampling.Thereafter
+		if thereafter <= 0 {
+			// NOTE: drop all entries after the initial ones
+			thereafter = math.MaxInt32
+		}
+		core = zapcore.NewSampler(core, c.Sampling.Tick, c.Sampling.Initial, thereafter)
 	}
 
-	writerSyncer := zapcore.AddSync(writer)
-	logger := zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-		zapcore.Lock(writerSyncer),
-		level,
-	), zap.ErrorOutput(writerSyncer))
+	logger := zap.New(core, zap.ErrorOutput(errorOutput))
+	if len(files) != 0 {
+		loggerFiles.mu.Lock()
+		loggerFiles.m[logger] = files
+		loggerFiles.mu.Unlock()
+	}
+	return logger, level, nil
+}
+
+var loggerFiles = struct {
+	mu sync.Mutex
+	m  map[*zap.Logger][]*File
+}{m: make(map[*zap.Logger][]*File)}
+
+// Close closes the files of the logger returned by NewLogger, which are reopened by Reopen until then.
+func Close(logger *zap.Logger) error {
+	loggerFiles.mu.Lock()
+	files := loggerFiles.m[logger]
+	delete(loggerFiles.m, logger)
+	loggerFiles.mu.Unlock()
+
+	var err error
+	for _, f := range files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
 
-	return logger, nil
+// newWriter returns the file too if the output is a file.
+func newWriter(out string, rotate config.Rotate) (zapcore.WriteSyncer, *File, error) {
+	switch out {
+	case "stdout":
+		return zapcore.Lock(os.Stdout), nil, nil
+	case "stderr":
+		return zapcore.Lock(os.Stderr), nil, nil
+	case "discard":
+		return zapcore.AddSync(ioutil.Discard), nil, nil
+	}
+	// NOTE: File is safe for concurrent use
+	f, err := OpenFile(out, rotate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+// newEncoder returns the JSON encoder, or the human-readable console encoder for development.
+func newEncoder(encoding string) (zapcore.Encoder, error) {
+	switch encoding {
+	case "", "json":
+		return zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), nil
+	case "console":
+		return zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), nil
+	default:
+		return nil, fmt.Errorf("unknown log encoding type: %s", encoding)
+	}
+}
+
+// SetLevel changes the level of the loggers created with it.
+func SetLevel(level zap.AtomicLevel, text string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal level %s", text)
+	}
+	level.SetLevel(l)
+	return nil
 }
 
 func GRPCRequestToLogFields(_ *grpc.StreamServerInfo, start time.Time, err error) []zapcore.Field {
@@ -67,21 +181,110 @@ func GRPCRequestToLogFields(_ *grpc.StreamServerInfo, start time.Time, err error
 	}
 }
 
-func HTTPRequestToLogFields(r *http.Request) []zapcore.Field {
-	remoteAddr := r.RemoteAddr
-	if addr := r.Header.Get("X-Forwarded-For"); addr != "" {
-		remoteAddr = addr
+// trustedProxies holds []*net.IPNet of the proxies whose X-Forwarded-For is respected.
+var trustedProxies atomic.Value
+
+// SetTrustedProxies replaces the trusted proxies by IP addresses or CIDRs. ex) 10.0.0.0/8
+func SetTrustedProxies(proxies []string) error {
+	nets, err := parseProxies(proxies)
+	if err != nil {
+		return err
 	}
+	trustedProxies.Store(nets)
+	return nil
+}
 
-	return []zapcore.Field{
+func parseProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy: %s", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(addr string) bool {
+	nets, _ := trustedProxies.Load().([]*net.IPNet)
+	ip := net.ParseIP(strings.Trim(addr, "[]"))
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the nearest address which isn't a trusted proxy in X-Forwarded-For,
+// only if the peer is a trusted proxy. Otherwise the peer is returned, because the header can be spoofed by the client.
+// ex) "spoofed, 192.0.2.1, 10.0.0.2" from 10.0.0.1 returns 192.0.2.1 if 10.0.0.0/8 is trusted
+func forwardedFor(peer string, values []string) string {
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+	addrs := strings.Split(strings.Join(values, ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr := removePort(strings.TrimSpace(addrs[i]))
+		if addr == "" {
+			break
+		}
+		if !isTrustedProxy(addr) {
+			return addr
+		}
+		peer = addr
+	}
+	return peer
+}
+
+// RemoteAddr returns the address of the client without the port, respecting X-Forwarded-For from the trusted proxies.
+func RemoteAddr(r *http.Request) string {
+	return forwardedFor(removePort(r.RemoteAddr), r.Header["X-Forwarded-For"])
+}
+
+// RemoteAddrFromContext returns the address of the gRPC client without the port,
+// respecting x-forwarded-for from the trusted proxies.
+func RemoteAddrFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	var values []string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		values = md["x-forwarded-for"]
+	}
+	return forwardedFor(removePort(p.Addr.String()), values)
+}
+
+func HTTPRequestToLogFields(r *http.Request) []zapcore.Field {
+	fields := []zapcore.Field{
 		zap.String("user-agent", r.UserAgent()),
 		zap.String("referer", r.Referer()),
 		zap.Int64("content-length", r.ContentLength),
 		zap.String("host", r.Host),
 		zap.String("method", r.Method),
-		zap.String("remote-addr", removePort(remoteAddr)),
+		zap.String("remote-addr", RemoteAddr(r)),
 		zap.String("time", time.Now().Format(time.RFC3339Nano)),
 	}
+	if claims, ok := auth.FromContext(r.Context()); ok {
+		fields = append(fields, zap.String("subject", claims.Subject()))
+		if s := claims.CertificateSubject(); s != "" {
+			fields = append(fields, zap.String("cert-subject", s))
+		}
+	}
+
+	return fields
 }
 
 func removePort(remoteAddr string) string {
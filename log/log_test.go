@@ -1,9 +1,24 @@
 package log
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/openfresh/plasma/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestRemovePortV4(t *testing.T) {
@@ -19,3 +34,199 @@ func TestRemovePortV6(t *testing.T) {
 	actual := removePort("[::1]:60000")
 	assert.Equal("[::1]", actual)
 }
+
+func TestRemoteAddr(t *testing.T) {
+	require.NoError(t, SetTrustedProxies([]string{"10.0.0.0/8", "192.168.0.1"}))
+	defer SetTrustedProxies(nil)
+
+	cases := []struct {
+		remoteAddr string
+		forwarded  []string
+		expect     string
+	}{
+		{remoteAddr: "203.0.113.1:60000", expect: "203.0.113.1"},
+		// NOTE: X-Forwarded-For from the clients can be spoofed
+		{remoteAddr: "203.0.113.1:60000", forwarded: []string{"198.51.100.1"}, expect: "203.0.113.1"},
+		{remoteAddr: "10.0.0.1:60000", forwarded: []string{"198.51.100.1"}, expect: "198.51.100.1"},
+		{remoteAddr: "192.168.0.1:60000", forwarded: []string{"198.51.100.1"}, expect: "198.51.100.1"},
+		{remoteAddr: "192.168.0.2:60000", forwarded: []string{"198.51.100.1"}, expect: "192.168.0.2"},
+		// the addresses added by the client are ignored
+		{remoteAddr: "10.0.0.1:60000", forwarded: []string{"spoofed, 198.51.100.1"}, expect: "198.51.100.1"},
+		{remoteAddr: "10.0.0.1:60000", forwarded: []string{"spoofed", "198.51.100.1, 10.0.0.2"}, expect: "198.51.100.1"},
+		{remoteAddr: "10.0.0.1:60000", forwarded: []string{""}, expect: "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		r.Header["X-Forwarded-For"] = c.forwarded
+		assert.Equal(t, c.expect, RemoteAddr(r), "%s %v", c.remoteAddr, c.forwarded)
+
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: fakeAddr(c.remoteAddr)})
+		ctx = metadata.NewIncomingContext(ctx, metadata.MD{"x-forwarded-for": c.forwarded})
+		assert.Equal(t, c.expect, RemoteAddrFromContext(ctx), "%s %v", c.remoteAddr, c.forwarded)
+	}
+}
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	assert.NoError(t, SetTrustedProxies([]string{"10.0.0.0/8", "::1"}))
+	assert.Error(t, SetTrustedProxies([]string{"proxy"}))
+}
+
+func TestSetLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	logger, level, err := NewLoggerWithLevel(config.Log{
+		Out:   "discard",
+		Level: "info",
+	})
+	assert.NoError(err)
+	assert.False(logger.Core().Enabled(zapcore.DebugLevel))
+
+	assert.NoError(SetLevel(level, "debug"))
+	assert.True(logger.Core().Enabled(zapcore.DebugLevel))
+
+	assert.Error(SetLevel(level, "verbose"))
+	assert.True(logger.Core().Enabled(zapcore.DebugLevel))
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plasma-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "error.log")
+
+	logger, err := NewLogger(config.Log{
+		Out:   path,
+		Level: "debug",
+	})
+	require.NoError(t, err)
+	defer Close(logger)
+
+	const password = "p@ssw0rd"
+	redis := config.Redis{
+		Addr:     "localhost:6379",
+		Password: password,
+	}
+	c := config.Config{
+		Subscriber: config.Subscriber{Redis: redis},
+	}
+
+	logger.Info("object", zap.Object("redis", redis))
+	logger.Info("any", zap.Any("config", c), zap.Any("redis", redis), zap.Any("password", redis.Password))
+	logger.Info("reflect", zap.Reflect("config", c))
+	logger.Info("stringer", zap.Stringer("password", redis.Password))
+	logger.Sugar().Infof("sprintf %v %+v %#v", redis, c, redis.Password)
+	require.NoError(t, logger.Sync())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), password)
+	assert.Contains(t, string(b), "REDACTED")
+}
+
+func TestTee(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "plasma-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	jsonPath := filepath.Join(dir, "json.log")
+	consolePath := filepath.Join(dir, "console.log")
+	errorPath := filepath.Join(dir, "error.log")
+
+	logger, level, err := NewLoggerWithLevel(config.Log{
+		Out:   jsonPath,
+		Level: "info",
+		Tee: config.LogSinks{
+			{Out: consolePath, Encoding: "console"},
+			{Out: errorPath, Level: "error"},
+		},
+	})
+	require.NoError(t, err)
+	defer Close(logger)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Error("error")
+	// NOTE: sinks without their own level follow the level
+	require.NoError(t, SetLevel(level, "debug"))
+	logger.Debug("debug after")
+	require.NoError(t, logger.Sync())
+
+	read := func(path string) string {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	s := read(jsonPath)
+	assert.NotContains(s, `"msg":"debug"`)
+	assert.Contains(s, `"msg":"info"`)
+	assert.Contains(s, `"msg":"error"`)
+	assert.Contains(s, `"msg":"debug after"`)
+
+	s = read(consolePath)
+	assert.NotContains(s, "{")
+	assert.Contains(s, "INFO\tinfo")
+	assert.Contains(s, "DEBUG\tdebug after")
+
+	s = read(errorPath)
+	assert.NotContains(s, `"msg":"info"`)
+	assert.NotContains(s, `"msg":"debug after"`)
+	assert.Contains(s, `"msg":"error"`)
+
+	_, err = NewLogger(config.Log{Out: "discard", Level: "info", Encoding: "text"})
+	assert.EqualError(err, "unknown log encoding type: text")
+
+	// NOTE: the files opened for the former sinks are closed if a later sink fails
+	files.mu.Lock()
+	n := len(files.m)
+	files.mu.Unlock()
+	_, err = NewLogger(config.Log{
+		Out:   filepath.Join(dir, "failed.log"),
+		Level: "info",
+		Tee:   config.LogSinks{{Out: filepath.Join(dir, "no-such-dir", "tee.log")}},
+	})
+	assert.Error(err)
+	files.mu.Lock()
+	assert.Len(files.m, n)
+	files.mu.Unlock()
+}
+
+func TestSampling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plasma-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	logger, err := NewLogger(config.Log{
+		Out:   path,
+		Level: "info",
+		Sampling: config.LogSampling{
+			Initial:    2,
+			Thereafter: 3,
+			Tick:       time.Minute,
+		},
+	})
+	require.NoError(t, err)
+	defer Close(logger)
+
+	for i := 0; i < 10; i++ {
+		logger.Info("sse")
+	}
+	logger.Info("sse connect")
+	require.NoError(t, logger.Sync())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	// NOTE: 1st, 2nd, 5th and 8th entries, and the other message is counted separately
+	assert.Equal(t, 4, strings.Count(string(b), `"msg":"sse"`))
+	assert.Equal(t, 1, strings.Count(string(b), `"msg":"sse connect"`))
+}
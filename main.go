@@ -2,6 +2,8 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
+	"fmt"
 	"net"
 	_ "net/http/pprof"
 	"os"
@@ -16,15 +18,47 @@ import (
 
 	"net/http"
 
+	"github.com/openfresh/plasma/auth"
+	"github.com/openfresh/plasma/cluster"
 	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/manager"
 	"github.com/openfresh/plasma/metrics"
+	"github.com/openfresh/plasma/presence"
 	"github.com/openfresh/plasma/pubsub"
 	"github.com/openfresh/plasma/server"
 	"github.com/openfresh/plasma/subscriber"
+	"github.com/openfresh/plasma/trace"
 )
 
-func httpListener(logger *zap.Logger, config config.Config) net.Listener {
+func newTLSConfig(logger *zap.Logger, config config.Config) *tls.Config {
+	if config.TLS.CertFile == "" || config.TLS.KeyFile == "" {
+		return nil
+	}
+
+	tlsConfig, err := server.NewTLSConfig(config.TLS, logger)
+	if err != nil {
+		logger.Fatal("failed to load TLS credentials",
+			zap.Error(err),
+			zap.String("certFile", config.TLS.CertFile),
+			zap.String("keyFile", config.TLS.KeyFile),
+			zap.String("clientCAFile", config.TLS.ClientCAFile),
+		)
+	}
+
+	logger.Info("enable TLS mode",
+		zap.String("certFile", config.TLS.CertFile),
+		zap.String("keyFile", config.TLS.KeyFile),
+		zap.String("clientCAFile", config.TLS.ClientCAFile),
+		zap.String("clientAuth", config.TLS.ClientAuth.Type),
+		zap.Duration("reloadInterval", config.TLS.ReloadInterval),
+	)
+	return tlsConfig
+}
+
+func httpListener(logger *zap.Logger, config config.Config, tlsConfig *tls.Config) net.Listener {
 	l, err := net.Listen("tcp", ":"+config.Port)
 	if err != nil {
 		logger.Fatal("failed to http(https) listen",
@@ -33,23 +67,8 @@ func httpListener(logger *zap.Logger, config config.Config) net.Listener {
 		)
 	}
 
-	if config.TLS.CertFile != "" && config.TLS.KeyFile != "" {
-		cer, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
-		if err != nil {
-			logger.Fatal("failed to load TLS credentials for TCP",
-				zap.Error(err),
-				zap.String("certFile", config.TLS.CertFile),
-				zap.String("keyFile", config.TLS.KeyFile),
-			)
-		}
-
-		logger.Info("enable TLS mode",
-			zap.String("certFile", config.TLS.CertFile),
-			zap.String("keyFile", config.TLS.KeyFile),
-		)
-		return tls.NewListener(l, &tls.Config{
-			Certificates: []tls.Certificate{cer},
-		})
+	if tlsConfig != nil {
+		return tls.NewListener(l, tlsConfig)
 	}
 
 	logger.Info("non TLS mode")
@@ -78,17 +97,51 @@ func grpcListener(logger *zap.Logger, config config.Config) net.Listener {
 	return l
 }
 
+func loadConfig(path string) config.Config {
+	c, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// printConfig prints the effective config with secrets redacted.
+func printConfig(path string) {
+	if err := config.Dump(os.Stdout, loadConfig(path)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
 func main() {
-	config := config.New()
+	configPath := flag.String("config", "", "path to the config file (YAML). environment variables override it")
+	flag.Parse()
+
+	// ex) plasma config print --config plasma.yaml
+	if args := flag.Args(); len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		fs := flag.NewFlagSet("config print", flag.ExitOnError)
+		fs.StringVar(configPath, "config", *configPath, "path to the config file (YAML)")
+		fs.Parse(args[2:])
+		printConfig(*configPath)
+		return
+	}
+
+	config := loadConfig(*configPath)
+	if err := log.SetTrustedProxies(config.TrustedProxies); err != nil {
+		panic(err)
+	}
 
-	accessLogger, err := log.NewLogger(config.AccessLog)
+	accessLogger, accessLevel, err := log.NewLoggerWithLevel(config.AccessLog)
 	if err != nil {
 		panic(err)
 	}
-	errorLogger, err := log.NewLogger(config.ErrorLog)
+	defer log.Close(accessLogger)
+	errorLogger, errorLevel, err := log.NewLoggerWithLevel(config.ErrorLog)
 	if err != nil {
 		panic(err)
 	}
+	defer log.Close(errorLogger)
 
 	go func() {
 		if err := http.ListenAndServe(config.Pprof.Host+":"+config.Pprof.Port, nil); err != nil {
@@ -98,7 +151,8 @@ func main() {
 		}
 	}()
 
-	l := httpListener(errorLogger, config)
+	tlsConfig := newTLSConfig(errorLogger, config)
+	l := httpListener(errorLogger, config, tlsConfig)
 	defer l.Close()
 	gl := grpcListener(errorLogger, config)
 	defer gl.Close()
@@ -127,24 +181,118 @@ func main() {
 		}
 	}()
 
+	metrics.SetEventTypeConfig(config.Metrics.EventType)
+
+	if config.Tracing.Endpoint != "" {
+		tracer, err := trace.New(config.Tracing, errorLogger)
+		if err != nil {
+			errorLogger.Fatal("failed to create tracer",
+				zap.Error(err),
+				zap.String("endpoint", config.Tracing.Endpoint),
+			)
+		}
+		trace.SetTracer(tracer)
+		defer tracer.Stop()
+	}
+
 	// Start Metrics
-	if config.Metrics.Type != "" {
-		metrics, err := metrics.NewMetrics(config)
+	metricsRunner := &metricsRunner{}
+	if err := metricsRunner.apply(config); err != nil {
+		errorLogger.Fatal("failed to create metrics",
+			zap.Error(err),
+		)
+	}
+	defer metricsRunner.stop()
+
+	// For Cluster
+	var clusterNode *cluster.Cluster
+	var clusterStatser server.ClusterStatser
+	if config.Cluster.Type != "" {
+		clusterNode, err = cluster.New(config, errorLogger)
+		if err != nil {
+			errorLogger.Fatal("failed to create cluster",
+				zap.Error(err),
+				zap.String("type", config.Cluster.Type),
+			)
+		}
+		clusterStatser = clusterNode
+	}
+
+	// NOTE: the observers are notified when clients subscribe to or unsubscribe from event types
+	var observers manager.SubscriptionObservers
+	// NOTE: the redis subscriber in the interest mode subscribes to the channels of the local subscribers
+	if o, ok := sub.(manager.SubscriptionObserver); ok {
+		observers = append(observers, o)
+	}
+
+	// For Presence
+	if len(config.Presence.EventTypes) != 0 {
+		validator, err := event.NewValidator(config.Subscription)
+		if err != nil {
+			errorLogger.Fatal("failed to create the validator of presence",
+				zap.Error(err),
+			)
+		}
+		tracker := presence.New(config.Presence, validator, pubsuber, errorLogger)
+		// NOTE: the counts of the other nodes are aggregated via the cluster
+		if clusterNode != nil {
+			clusterNode.SetPresence(tracker.Counts)
+			tracker.SetRemote(clusterNode.RemotePresence)
+		}
+		tracker.Start()
+		defer tracker.Stop()
+		observers = append(observers, tracker)
+	}
+	var observer manager.SubscriptionObserver
+	if len(observers) != 0 {
+		observer = observers
+	}
+
+	if clusterNode != nil {
+		clusterNode.Start()
+		defer clusterNode.Stop()
+		errorLogger.Info("joined the cluster",
+			zap.String("node-id", clusterNode.ID()),
+		)
+	}
+
+	var authenticator auth.Authenticator
+	if config.Auth.Type != "" {
+		authenticator, err = auth.New(config.Auth)
 		if err != nil {
-			errorLogger.Fatal("failed to create metrics",
+			errorLogger.Fatal("failed to create authenticator",
 				zap.Error(err),
+				zap.String("type", config.Auth.Type),
 			)
 		}
-		metrics.Start()
-		defer metrics.Stop()
 	}
 
+	var authorizer auth.Authorizer
+	if config.Auth.Authorization.Type != "" {
+		authorizer, err = auth.NewAuthorizer(config.Auth.Authorization)
+		if err != nil {
+			errorLogger.Fatal("failed to create authorizer",
+				zap.Error(err),
+				zap.String("type", config.Auth.Authorization.Type),
+			)
+		}
+	}
+
+	limiter := limit.New(config.Limit)
+	drainer := server.NewDrainer(config.Drain, errorLogger)
+
 	// For Native Client
 	grpcServerOption := server.Option{
-		PubSuber:     pubsuber,
-		AccessLogger: accessLogger,
-		ErrorLogger:  errorLogger,
-		Config:       config,
+		PubSuber:      pubsuber,
+		AccessLogger:  accessLogger,
+		ErrorLogger:   errorLogger,
+		Config:        config,
+		Authenticator: authenticator,
+		Authorizer:    authorizer,
+		TLSConfig:     tlsConfig,
+		Limiter:       limiter,
+		Drainer:       drainer,
+		Observer:      observer,
 	}
 
 	grpcServer, err := server.NewGRPCServer(grpcServerOption)
@@ -156,10 +304,15 @@ func main() {
 
 	// For Web Front End
 	sseServerOption := server.Option{
-		PubSuber:     pubsuber,
-		AccessLogger: accessLogger,
-		ErrorLogger:  errorLogger,
-		Config:       config,
+		PubSuber:      pubsuber,
+		AccessLogger:  accessLogger,
+		ErrorLogger:   errorLogger,
+		Config:        config,
+		Authenticator: authenticator,
+		Authorizer:    authorizer,
+		Limiter:       limiter,
+		Drainer:       drainer,
+		Observer:      observer,
 	}
 	sseHandler, err := server.NewSSEHandler(sseServerOption)
 	if err != nil {
@@ -173,6 +326,7 @@ func main() {
 		AccessLogger: accessLogger,
 		ErrorLogger:  errorLogger,
 		Config:       config,
+		Cluster:      clusterStatser,
 	})
 
 	// For Meta (HealthCheck)
@@ -180,46 +334,140 @@ func main() {
 		AccessLogger: accessLogger,
 		ErrorLogger:  errorLogger,
 		Config:       config,
+		Limiter:      limiter,
+		Drainer:      drainer,
+		Subscriber:   sub,
+		FanOuts: map[string]server.Pinger{
+			limit.SSE:  sseHandler,
+			limit.GRPC: grpcServer,
+		},
 	})
 
+	// NOTE: the CORS policy is applied to all endpoints of the HTTP server and the admin API
+	corsHandler := server.NewCORSHandler(server.Option{
+		Config: config,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept")
+		if accept == "text/event-stream" {
+			sseHandler.ServeHTTP(w, r)
+		} else {
+			metaHandler.ServeHTTP(w, r)
+		}
+	}))
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/", metricsHandler)
+
+	// For Admin API
+	if config.Admin.TokenFile != "" {
+		adminHandler, err := server.NewAdminHandler(server.Option{
+			AccessLogger: accessLogger,
+			ErrorLogger:  errorLogger,
+			Config:       config,
+			Cluster:      clusterStatser,
+		}, sseHandler.ClientManager(), grpcServer.ClientManager())
+		if err != nil {
+			errorLogger.Fatal("failed to create admin handler",
+				zap.Error(err),
+				zap.String("tokenFile", config.Admin.TokenFile),
+			)
+		}
+		// NOTE: the browser preflight is answered without the admin token
+		metricsMux.Handle("/admin/", corsHandler.Wrap(adminHandler))
+	}
+
 	metricsServer := &http.Server{
-		Handler: metricsHandler,
+		Handler: metricsMux,
 	}
 
 	httpServer := &http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			accept := r.Header.Get("Accept")
-			if accept == "text/event-stream" {
-				sseHandler.ServeHTTP(w, r)
-			} else {
-				metaHandler.ServeHTTP(w, r)
-			}
-		}),
+		Handler: corsHandler,
 	}
 
+	// NOTE: SIGHUP reloads the config instead of shutting down
+	reloader := newReloader(*configPath, config, errorLogger, reloadables{
+		accessLevel: accessLevel,
+		errorLevel:  errorLevel,
+		cors:        corsHandler,
+		sse:         sseHandler,
+		limiter:     limiter,
+		subscriber:  sub,
+		metrics:     metricsRunner,
+	})
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			errorLogger.Info("reload config...")
+			reloader.reload()
+		}
+	}()
+
+	// NOTE: SIGUSR1 reopens the log files after logrotate moves them
+	usr1Ch := make(chan os.Signal, 1)
+	signal.Notify(usr1Ch, syscall.SIGUSR1)
+	go func() {
+		for range usr1Ch {
+			if err := log.Reopen(); err != nil {
+				errorLogger.Error("failed to reopen log files",
+					zap.Error(err),
+				)
+				continue
+			}
+			errorLogger.Info("reopened log files")
+		}
+	}()
+
 	// for graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(
 		sigCh,
-		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGQUIT,
 		syscall.SIGTERM,
 	)
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		<-sigCh
 
+		ctx, cancel := context.WithTimeout(context.Background(), config.Drain.Timeout)
+		defer cancel()
+
+		// NOTE: SSE responses and gRPC streams never end by themselves, so close them before shutdown
+		errorLogger.Info("drain connections...")
+		drainer.Drain(ctx, sseHandler.ClientManager(), grpcServer.ClientManager())
+
 		eg := errgroup.Group{}
 		eg.Go(func() error {
 			errorLogger.Info("shutdown gRPC Server gracefully...")
-			grpcServer.GracefulStop()
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				errorLogger.Info("force to stop gRPC Server")
+				grpcServer.Stop()
+			}
 			return nil
 		})
 		eg.Go(func() error {
 			errorLogger.Info("shutdown httpServer gracefully...")
-			return httpServer.Shutdown(context.Background())
+			err := httpServer.Shutdown(ctx)
+			if err == context.DeadlineExceeded {
+				errorLogger.Info("force to close httpServer")
+				return httpServer.Close()
+			}
+			return err
 		})
-		if err := eg.Wait(); err != nil {
+		err := eg.Wait()
+		// NOTE: stop the delivery workers after the connections are closed
+		sseHandler.ClientManager().Close()
+		grpcServer.ClientManager().Close()
+		if err != nil {
 			opErr, ok := err.(*net.OpError)
 
 			// NOTE: Ignore errors that occur when closing the file descriptor because it is an assumed error.
@@ -233,7 +481,8 @@ func main() {
 	}()
 
 	go func() {
-		if err := grpcServer.Serve(gl); err != nil {
+		// NOTE: Serve returns an error when the server is stopped
+		if err := grpcServer.Serve(gl); err != nil && !drainer.Draining() {
 			errorLogger.Fatal("failed to gRPC serve",
 				zap.Error(err),
 			)
@@ -248,10 +497,12 @@ func main() {
 		}
 	}()
 
-	if err := httpServer.Serve(l); err != nil {
+	if err := httpServer.Serve(l); err != nil && err != http.ErrServerClosed {
 		errorLogger.Fatal("failed to HTTP serve",
 			zap.Error(err),
 		)
 	}
+	// NOTE: Serve returns as soon as Shutdown is called, so wait for the connections to be closed
+	<-shutdown
 
 }
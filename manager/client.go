@@ -1,77 +1,281 @@
 package manager
 
 import (
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/openfresh/plasma/trace"
 )
 
 type Client struct {
+	id          string
+	info        ClientInfo
+	connectedAt time.Time
 	events      []string
 	payloadChan chan event.Payload
+	// NOTE: copies of the client share the close channel
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+// ClientInfo describes the connection of a client.
+type ClientInfo struct {
+	Transport  string
+	RemoteAddr string
+	UserAgent  string
+	Subject    string
+}
+
+func (c *Client) ID() string {
+	return c.id
 }
 
 func (c *Client) ReceivePayload() <-chan event.Payload {
 	return c.payloadChan
 }
 
-func (c *Client) SetEvents(events []string) {
-	c.events = events
+// Closed is closed when the client is disconnected forcibly or removed.
+func (c *Client) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Close disconnects the client. The transport ends the connection when Closed is closed.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
 }
 
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+var lastClientID uint64
+
 func NewClient(events []string) Client {
+	return NewClientWithInfo(events, ClientInfo{})
+}
+
+func NewClientWithInfo(events []string, info ClientInfo) Client {
 	return Client{
+		id:          strconv.FormatUint(atomic.AddUint64(&lastClientID, 1), 10),
+		info:        info,
+		connectedAt: time.Now(),
 		events:      events,
 		payloadChan: make(chan event.Payload, 20),
+		closed:      make(chan struct{}),
+		closeOnce:   &sync.Once{},
+	}
+}
+
+const (
+	// NOTE: the number of shards must be a power of 2
+	shardCount = 32
+	// deliveryBatchSize is the number of clients which a worker delivers a payload to at once.
+	deliveryBatchSize = 128
+)
+
+// subscriptionShard indexes the queues of the clients by the event types which they subscribe.
+// The values are the close channels of the clients.
+type subscriptionShard struct {
+	mu      sync.RWMutex
+	clients map[string]map[chan event.Payload]chan struct{}
+}
+
+// target is the queue of a client to deliver a payload to.
+type target struct {
+	queue  chan event.Payload
+	closed chan struct{}
+}
+
+// deliveryBatch is a batch of the targets delivered by a worker.
+type deliveryBatch struct {
+	targets []target
+	payload event.Payload
+	wg      *sync.WaitGroup
+}
+
+// clientShard holds the clients by ID for the admin API.
+type clientShard struct {
+	mu      sync.RWMutex
+	clients map[string]Client
+}
+
+// SubscriptionObserver is notified when a subscriber joins or leaves an event type.
+// It is called in the fan-out loop, so it must not block. ex) *presence.Tracker
+type SubscriptionObserver interface {
+	Join(eventType string)
+	Leave(eventType string)
+}
+
+// SubscriptionObservers notifies all of the observers.
+type SubscriptionObservers []SubscriptionObserver
+
+func (os SubscriptionObservers) Join(eventType string) {
+	for _, o := range os {
+		o.Join(eventType)
 	}
 }
 
-type Clients struct {
-	clients map[chan event.Payload]struct{}
-	mu      *sync.RWMutex
+func (os SubscriptionObservers) Leave(eventType string) {
+	for _, o := range os {
+		o.Leave(eventType)
+	}
 }
 
+// ClientManager indexes the clients by the event types, and delivers payloads to them.
+// The indexes are sharded and guarded by their own locks, so that they can be read by the workers
+// and the admin API while the clients are added and removed.
 type ClientManager struct {
-	clientsTable map[string]Clients
+	subscriptions [shardCount]subscriptionShard
+	clients       [shardCount]clientShard
+	workers       int
+	batches       chan deliveryBatch
+	done          chan struct{}
+	closeOnce     sync.Once
+	observer      SubscriptionObserver
+	encoder       Encoder
+	// NOTE: targets pools the slices of the queues to deliver a payload to
+	targets sync.Pool
 }
 
-func (cm *ClientManager) AddClient(client Client) {
-	for _, e := range client.events {
-		if cm.clientsTable[e].clients == nil {
-			cm.clientsTable[e] = Clients{
-				clients: make(map[chan event.Payload]struct{}),
-				mu:      &sync.RWMutex{},
-			}
+// shardIndex returns the shard of the key by FNV-1a, which is inlined not to allocate a hash.
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h & (shardCount - 1))
+}
+
+func (cm *ClientManager) subscriptionShard(eventType string) *subscriptionShard {
+	return &cm.subscriptions[shardIndex(eventType)]
+}
+
+func (cm *ClientManager) clientShard(id string) *clientShard {
+	return &cm.clients[shardIndex(id)]
+}
+
+// eachClient calls f with the clients of each shard. f must not call methods which lock the shard.
+func (cm *ClientManager) eachClient(f func(Client)) {
+	for i := range cm.clients {
+		s := &cm.clients[i]
+		s.mu.RLock()
+		for _, c := range s.clients {
+			f(c)
 		}
-		cm.clientsTable[e].mu.Lock()
-		cm.clientsTable[e].clients[client.payloadChan] = struct{}{}
-		cm.clientsTable[e].mu.Unlock()
+		s.mu.RUnlock()
 	}
 }
 
+// AddClient, RemoveClient and SetEvents are serialized by the client ID, and the events of the client are
+// read from the copy in the manager, so that they are consistent with the index even if they race.
+func (cm *ClientManager) AddClient(client Client) {
+	cs := cm.clientShard(client.id)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// NOTE: the client can be removed before it is added
+	if client.isClosed() {
+		return
+	}
+	cs.clients[client.id] = client
+	cm.subscribe(client)
+}
+
+// RemoveClient closes the client. The queue isn't closed, because the workers may still have it,
+// so the transports must stop receiving when Closed is closed.
 func (cm *ClientManager) RemoveClient(client Client) {
+	cs := cm.clientShard(client.id)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	client.Close()
+	if c, ok := cs.clients[client.id]; ok {
+		delete(cs.clients, client.id)
+		cm.unsubscribe(c)
+	}
+}
+
+// SetEvents replaces the events of the client. It returns false if the client has been removed.
+func (cm *ClientManager) SetEvents(id string, events []string) bool {
+	cs := cm.clientShard(id)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.clients[id]
+	if !ok {
+		return false
+	}
+	cm.unsubscribe(c)
+	c.events = events
+	cs.clients[id] = c
+	cm.subscribe(c)
+	return true
+}
+
+func (cm *ClientManager) subscribe(client Client) {
 	for _, e := range client.events {
-		clients, ok := cm.clientsTable[e]
+		s := cm.subscriptionShard(e)
+		s.mu.Lock()
+		subscribers, ok := s.clients[e]
 		if !ok {
-			continue
+			subscribers = make(map[chan event.Payload]chan struct{})
+			s.clients[e] = subscribers
+		}
+		_, exists := subscribers[client.payloadChan]
+		if !exists {
+			subscribers[client.payloadChan] = client.closed
+		}
+		s.mu.Unlock()
+
+		if !exists {
+			metrics.IncEventSubscriber(e)
+			cm.join(e)
 		}
-		clients.mu.Lock()
-		delete(clients.clients, client.payloadChan)
-		clients.mu.Unlock()
 	}
-	close(client.payloadChan)
 }
 
-func (cm *ClientManager) DeleteEvents(client *Client) {
+func (cm *ClientManager) unsubscribe(client Client) {
 	for _, e := range client.events {
-		clients, ok := cm.clientsTable[e]
-		if !ok {
-			continue
+		s := cm.subscriptionShard(e)
+		s.mu.Lock()
+		subscribers := s.clients[e]
+		_, exists := subscribers[client.payloadChan]
+		if exists {
+			delete(subscribers, client.payloadChan)
+			// NOTE: remove the event type not to keep the long tail of event types in the index
+			if len(subscribers) == 0 {
+				delete(s.clients, e)
+			}
 		}
-		clients.mu.Lock()
-		delete(clients.clients, client.payloadChan)
-		clients.mu.Unlock()
+		s.mu.Unlock()
+
+		if exists {
+			metrics.DecEventSubscriber(e)
+			cm.leave(e)
+		}
+	}
+}
+
+func (cm *ClientManager) join(eventType string) {
+	if cm.observer != nil {
+		cm.observer.Join(eventType)
+	}
+}
+
+func (cm *ClientManager) leave(eventType string) {
+	if cm.observer != nil {
+		cm.observer.Leave(eventType)
 	}
 }
 
@@ -91,61 +295,179 @@ func (cm *ClientManager) createEvents(request string) []string {
 	return events
 }
 
-func (cm *ClientManager) SendPayload(payload event.Payload) {
-	events := cm.createEvents(payload.Meta.Type)
-	wg := sync.WaitGroup{}
+// collect appends the queues of the clients subscribing the event types to targets.
+// The queues are copied under the locks, so that the clients can be added and removed during the delivery.
+func (cm *ClientManager) collect(targets []target, events ...string) []target {
 	for _, e := range events {
+		s := cm.subscriptionShard(e)
+		s.mu.RLock()
+		for queue, closed := range s.clients[e] {
+			targets = append(targets, target{queue: queue, closed: closed})
+		}
+		s.mu.RUnlock()
+	}
+	return targets
+}
+
+func (cm *ClientManager) getTargets() *[]target {
+	if targets, ok := cm.targets.Get().(*[]target); ok {
+		return targets
+	}
+	targets := make([]target, 0, deliveryBatchSize)
+	return &targets
+}
+
+func (cm *ClientManager) putTargets(targets *[]target) {
+	// NOTE: clear the queues not to keep the removed clients from GC
+	for i := range *targets {
+		(*targets)[i] = target{}
+	}
+	*targets = (*targets)[:0]
+	cm.targets.Put(targets)
+}
+
+// deliver sends the payload to the targets by the worker pool, and returns when all of them receive it.
+// A batch of clients is delivered in the caller without the workers.
+func (cm *ClientManager) deliver(targets []target, payload event.Payload) {
+	if len(targets) <= deliveryBatchSize {
+		sendBatch(targets, payload)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for start := 0; start < len(targets); start += deliveryBatchSize {
+		end := start + deliveryBatchSize
+		if end > len(targets) {
+			end = len(targets)
+		}
 		wg.Add(1)
-		go func(e string) {
-			defer wg.Done()
-			clientsTable, ok := cm.clientsTable[e]
-			if !ok {
-				return
-			}
-			clientsTable.mu.RLock()
-			clients := clientsTable.clients
-			clientsTable.mu.RUnlock()
-			wg2 := sync.WaitGroup{}
-			for client := range clients {
-				wg2.Add(1)
-				go func(client chan event.Payload) {
-					defer wg2.Done()
-					sendPayloadSafety(client, payload)
-				}(client)
-			}
-			wg2.Wait()
-		}(e)
+		b := deliveryBatch{targets: targets[start:end], payload: payload, wg: &wg}
+		select {
+		case cm.batches <- b:
+		case <-cm.done:
+			// NOTE: the workers are stopped by Close
+			sendBatch(b.targets, b.payload)
+			wg.Done()
+		}
 	}
 	wg.Wait()
 }
 
-func sendPayloadSafety(client chan event.Payload, payload event.Payload) {
-	defer func() {
-		if err := recover(); err != nil {
+// work delivers the batches until Close is called.
+// NOTE: the batches channel is unbuffered not to leave the batches after the workers stop
+func (cm *ClientManager) work() {
+	for {
+		select {
+		case b := <-cm.batches:
+			sendBatch(b.targets, b.payload)
+			b.wg.Done()
+		case <-cm.done:
 			return
 		}
-	}()
-	client <- payload
-	return
+	}
 }
 
-const heartBeatEvent = "heartbeat"
+// Close stops the workers. Payloads sent after Close are delivered by the caller.
+func (cm *ClientManager) Close() {
+	cm.closeOnce.Do(func() {
+		close(cm.done)
+	})
+}
 
-func (cm *ClientManager) SendHeartBeat() {
-	clients, ok := cm.clientsTable[heartBeatEvent]
-	if !ok {
+func (cm *ClientManager) SendPayload(payload event.Payload) {
+	now := time.Now()
+	if !payload.ReceivedAt.IsZero() {
+		metrics.ObserveIngestToEnqueue(now.Sub(payload.ReceivedAt))
+	}
+	payload.EnqueuedAt = now
+
+	span := trace.Start("plasma.fanout", trace.FromTraceparent(payload.Meta.Traceparent), trace.KindInternal)
+	defer span.End()
+	span.SetAttribute("plasma.event_type", payload.Meta.Type)
+	payload.Meta.Traceparent = span.Traceparent()
+
+	targets := cm.getTargets()
+	defer cm.putTargets(targets)
+	*targets = cm.collect(*targets, cm.createEvents(payload.Meta.Type)...)
+	// NOTE: don't encode the payload which no client receives
+	if len(*targets) == 0 {
 		return
 	}
-	clients.mu.RLock()
-	c := clients.clients
-	clients.mu.RUnlock()
-	for send := range c {
-		send <- event.Payload{Meta: event.MetaData{Type: heartBeatEvent}}
+	if cm.encoder != nil {
+		encoded, err := cm.encoder(payload)
+		if err != nil {
+			span.SetError(err)
+			metrics.IncPayloadDropped()
+			return
+		}
+		payload.Encoded = encoded
 	}
+	cm.deliver(*targets, payload)
+}
+
+// sendBatch sends without blocking first, so that slow clients don't delay the others in the batch.
+// Payloads to the removed clients are dropped.
+func sendBatch(targets []target, payload event.Payload) {
+	var pending []target
+	for _, t := range targets {
+		select {
+		case t.queue <- payload:
+		case <-t.closed:
+			metrics.IncPayloadDropped()
+		default:
+			pending = append(pending, t)
+		}
+	}
+	for _, t := range pending {
+		select {
+		case t.queue <- payload:
+		case <-t.closed:
+			metrics.IncPayloadDropped()
+		}
+	}
+}
+
+const heartBeatEvent = "heartbeat"
+
+func (cm *ClientManager) SendHeartBeat() {
+	targets := cm.getTargets()
+	*targets = cm.collect(*targets, heartBeatEvent)
+	cm.deliver(*targets, event.Payload{Meta: event.MetaData{Type: heartBeatEvent}})
+	cm.putTargets(targets)
+}
+
+// Encoder serializes the payload for the transport once before it is delivered to the clients.
+// The payload is dropped if it fails.
+type Encoder func(payload event.Payload) (*event.Encoded, error)
+
+// Option configures the ClientManager. nil fields are disabled.
+type Option struct {
+	// Observer is notified of the subscribers
+	Observer SubscriptionObserver
+	// Encoder sets event.Payload.Encoded of the payloads
+	Encoder Encoder
 }
 
 func NewClientManager() *ClientManager {
-	return &ClientManager{
-		clientsTable: make(map[string]Clients),
+	return NewClientManagerWithOption(Option{})
+}
+
+func NewClientManagerWithOption(opt Option) *ClientManager {
+	cm := &ClientManager{
+		workers:  runtime.GOMAXPROCS(0),
+		batches:  make(chan deliveryBatch),
+		done:     make(chan struct{}),
+		observer: opt.Observer,
+		encoder:  opt.Encoder,
+	}
+	for i := range cm.subscriptions {
+		cm.subscriptions[i].clients = make(map[string]map[chan event.Payload]chan struct{})
+	}
+	for i := range cm.clients {
+		cm.clients[i].clients = make(map[string]Client)
+	}
+	for i := 0; i < cm.workers; i++ {
+		go cm.work()
 	}
+	return cm
 }
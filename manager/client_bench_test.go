@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/openfresh/plasma/event"
+)
+
+func benchmarkSendPayload(b *testing.B, subscribers int) {
+	cm := NewClientManager()
+	clients := make([]Client, subscribers)
+	for i := range clients {
+		clients[i] = NewClient([]string{"program:1234"})
+		cm.AddClient(clients[i])
+	}
+	payload := event.Payload{
+		Meta: event.MetaData{Type: "program:1234:views"},
+		Data: json.RawMessage(`{"views": 1}`),
+	}
+	size := cap(clients[0].payloadChan)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// NOTE: drain the queues before they are full not to measure blocking on slow clients
+		if i%size == size-1 {
+			b.StopTimer()
+			for _, c := range clients {
+				for len(c.payloadChan) > 0 {
+					<-c.payloadChan
+				}
+			}
+			b.StartTimer()
+		}
+		cm.SendPayload(payload)
+	}
+}
+
+func BenchmarkSendPayload(b *testing.B) {
+	for _, n := range []int{1, 100, 10000, 100000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkSendPayload(b, n)
+		})
+	}
+}
+
+// BenchmarkAddRemoveClient measures subscribing and unsubscribing, which are concurrent with the admin API.
+func BenchmarkAddRemoveClient(b *testing.B) {
+	cm := NewClientManager()
+	events := []string{"program:1234", "program:1234:views", "program:5678"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := NewClient(events)
+		cm.AddClient(c)
+		cm.RemoveClient(c)
+	}
+}
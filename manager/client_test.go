@@ -2,6 +2,7 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 	"sync"
 	"testing"
@@ -10,6 +11,15 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// eventTypeNum returns the number of the event types which have subscribers in all shards.
+func eventTypeNum(cm *ClientManager) int {
+	n := 0
+	for i := range cm.subscriptions {
+		n += len(cm.subscriptions[i].clients)
+	}
+	return n
+}
+
 func TestAddClient(t *testing.T) {
 	cases := []struct {
 		Test Client
@@ -28,13 +38,13 @@ func TestAddClient(t *testing.T) {
 
 	assert := assert.New(t)
 
-	assert.Equal(eventCnt, len(cm.clientsTable), "should be equal")
+	assert.Equal(eventCnt, eventTypeNum(cm), "should be equal")
 
 	for _, c := range cases {
 		for _, e := range c.Test.events {
-			ch, ok := cm.clientsTable[e]
+			clients, ok := cm.subscriptionShard(e).clients[e]
 			assert.True(ok, "shuold be true")
-			_, ok = ch.clients[c.Test.payloadChan]
+			_, ok = clients[c.Test.payloadChan]
 			assert.True(ok, "should be true")
 		}
 	}
@@ -66,19 +76,16 @@ func TestRemoveClient(t *testing.T) {
 
 	assert := assert.New(t)
 
-	assert.Equal(len(eventSet), len(cm.clientsTable), "should be equal")
+	assert.Equal(len(eventSet), eventTypeNum(cm), "should be equal")
 
 	for _, c := range cases {
 		cm.RemoveClient(c.Test)
-		_, ok := <-c.Test.payloadChan
-		assert.False(ok, "should be close channel")
+		_, ok := <-c.Test.Closed()
+		assert.False(ok, "should be closed")
 	}
 
-	for _, c := range cases {
-		for _, e := range c.Test.events {
-			assert.Len(cm.clientsTable[e].clients, 0, "should be empty")
-		}
-	}
+	// NOTE: the event types without subscribers are removed
+	assert.Equal(0, eventTypeNum(cm), "should be empty")
 
 }
 
@@ -150,7 +157,9 @@ func TestSendPayload(t *testing.T) {
 		go func(c Client) {
 			defer wg.Done()
 			p := <-c.payloadChan
-			assert.Equal(payload, p)
+			assert.Equal(payload.Meta, p.Meta)
+			assert.Equal(payload.Data, p.Data)
+			assert.False(p.EnqueuedAt.IsZero())
 		}(c)
 	}
 
@@ -186,3 +195,153 @@ func TestSendHeartBeat(t *testing.T) {
 
 	wg.Wait()
 }
+
+type fakeObserver struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (p *fakeObserver) Join(eventType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[eventType]++
+}
+
+func (p *fakeObserver) Leave(eventType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[eventType]--
+}
+
+func TestSubscriptionObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &fakeObserver{counts: make(map[string]int)}
+	other := &fakeObserver{counts: make(map[string]int)}
+	cm := NewClientManagerWithOption(Option{Observer: SubscriptionObservers{p, other}})
+
+	c1 := NewClient([]string{"program:1234", "program:1234:views"})
+	c2 := NewClient([]string{"program:1234"})
+	cm.AddClient(c1)
+	cm.AddClient(c2)
+	// NOTE: adding the same client again doesn't join twice
+	cm.AddClient(c2)
+	assert.Equal(map[string]int{"program:1234": 2, "program:1234:views": 1}, p.counts)
+
+	assert.True(cm.SetEvents(c1.ID(), []string{"news"}))
+	assert.Equal(map[string]int{"program:1234": 1, "program:1234:views": 0, "news": 1}, p.counts)
+
+	cm.RemoveClient(c1)
+	cm.RemoveClient(c2)
+	assert.Equal(map[string]int{"program:1234": 0, "program:1234:views": 0, "news": 0}, p.counts)
+	assert.Equal(p.counts, other.counts)
+
+	// NOTE: the events of the removed client are ignored
+	assert.False(cm.SetEvents(c1.ID(), []string{"news"}))
+	assert.Equal(0, eventTypeNum(cm))
+}
+
+func TestSetEventsRemoveClient(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &fakeObserver{counts: make(map[string]int)}
+	cm := NewClientManagerWithOption(Option{Observer: p})
+
+	// NOTE: refreshing the events races with removing the client like gRPC streams
+	for i := 0; i < 100; i++ {
+		c := NewClient([]string{})
+		cm.AddClient(c)
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cm.SetEvents(c.ID(), []string{"program:1234", "news"})
+		}()
+		go func() {
+			defer wg.Done()
+			cm.RemoveClient(c)
+		}()
+		wg.Wait()
+	}
+
+	assert.Equal(0, eventTypeNum(cm))
+	assert.Empty(cm.Connections(Filter{}))
+	assert.Equal(0, p.counts["program:1234"])
+	assert.Equal(0, p.counts["news"])
+}
+
+func TestSendPayloadEncoder(t *testing.T) {
+	assert := assert.New(t)
+
+	encoded := 0
+	var encodeErr error
+	cm := NewClientManagerWithOption(Option{
+		Encoder: func(payload event.Payload) (*event.Encoded, error) {
+			encoded++
+			return &event.Encoded{SSE: []byte("data: " + payload.Meta.Type + "\n\n")}, encodeErr
+		},
+	})
+	payload := event.Payload{
+		Meta: event.MetaData{Type: "program:1234:views"},
+	}
+
+	// NOTE: the payload which no client receives isn't encoded
+	cm.SendPayload(payload)
+	assert.Equal(0, encoded)
+
+	clients := []Client{
+		NewClient([]string{"program:1234"}),
+		NewClient([]string{"program:1234:views"}),
+	}
+	for _, c := range clients {
+		cm.AddClient(c)
+	}
+
+	// NOTE: the payload is encoded once and shared by the clients
+	cm.SendPayload(payload)
+	assert.Equal(1, encoded)
+	p1, p2 := <-clients[0].payloadChan, <-clients[1].payloadChan
+	assert.Equal("data: program:1234:views\n\n", string(p1.Encoded.SSE))
+	assert.True(p1.Encoded == p2.Encoded)
+
+	encodeErr = errors.New("failed to encode")
+	cm.SendPayload(payload)
+	assert.Equal(2, encoded)
+	for _, c := range clients {
+		assert.Len(c.payloadChan, 0)
+	}
+}
+
+func TestSendPayloadWorkers(t *testing.T) {
+	assert := assert.New(t)
+
+	cm := NewClientManager()
+	defer cm.Close()
+
+	clients := make([]Client, deliveryBatchSize*3+1)
+	for i := range clients {
+		clients[i] = NewClient([]string{"program:1234:views"})
+		cm.AddClient(clients[i])
+	}
+	// NOTE: the payloads to the removed client with the full queue are dropped without blocking
+	removed := clients[0]
+	for len(removed.payloadChan) < cap(removed.payloadChan) {
+		removed.payloadChan <- event.Payload{}
+	}
+	cm.RemoveClient(removed)
+
+	payload := event.Payload{
+		Meta: event.MetaData{Type: "program:1234:views"},
+	}
+	cm.SendPayload(payload)
+	for _, c := range clients[1:] {
+		assert.Len(c.payloadChan, 1)
+	}
+
+	// NOTE: the payloads are delivered by the caller after Close
+	cm.Close()
+	cm.SendPayload(payload)
+	for _, c := range clients[1:] {
+		assert.Len(c.payloadChan, 2)
+	}
+}
@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"sort"
+	"time"
+)
+
+// Connection is a snapshot of a connected client.
+type Connection struct {
+	ID          string    `json:"id"`
+	Transport   string    `json:"transport"`
+	RemoteAddr  string    `json:"remote_addr"`
+	UserAgent   string    `json:"user_agent"`
+	Subject     string    `json:"subject,omitempty"`
+	Events      []string  `json:"events"`
+	ConnectedAt time.Time `json:"connected_at"`
+	QueueDepth  int       `json:"queue_depth"`
+}
+
+func (c *Client) connection() Connection {
+	return Connection{
+		ID:          c.id,
+		Transport:   c.info.Transport,
+		RemoteAddr:  c.info.RemoteAddr,
+		UserAgent:   c.info.UserAgent,
+		Subject:     c.info.Subject,
+		Events:      c.events,
+		ConnectedAt: c.connectedAt,
+		QueueDepth:  len(c.payloadChan),
+	}
+}
+
+// Filter matches connections. Empty fields match any connection.
+type Filter struct {
+	Transport  string
+	RemoteAddr string
+	Subject    string
+	// Event matches connections subscribing the event type exactly.
+	Event string
+}
+
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+func (f Filter) Match(c Connection) bool {
+	if f.Transport != "" && f.Transport != c.Transport {
+		return false
+	}
+	if f.RemoteAddr != "" && f.RemoteAddr != c.RemoteAddr {
+		return false
+	}
+	if f.Subject != "" && f.Subject != c.Subject {
+		return false
+	}
+	if f.Event == "" {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == f.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// Connections returns the connections matching the filter, oldest first.
+func (cm *ClientManager) Connections(filter Filter) []Connection {
+	connections := make([]Connection, 0)
+	cm.eachClient(func(c Client) {
+		if conn := c.connection(); filter.Match(conn) {
+			connections = append(connections, conn)
+		}
+	})
+
+	sortConnections(connections)
+	return connections
+}
+
+// Subscribers returns the connections which receive payloads of the event type,
+// including connections subscribing its parents.
+func (cm *ClientManager) Subscribers(eventType string) []Connection {
+	events := cm.createEvents(eventType)
+
+	connections := make([]Connection, 0)
+	cm.eachClient(func(c Client) {
+		if subscribes(c.events, events) {
+			connections = append(connections, c.connection())
+		}
+	})
+
+	sortConnections(connections)
+	return connections
+}
+
+func subscribes(subscribed, events []string) bool {
+	for _, s := range subscribed {
+		for _, e := range events {
+			if s == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Disconnect disconnects the client forcibly. It returns false if there is no such client.
+func (cm *ClientManager) Disconnect(id string) bool {
+	s := cm.clientShard(id)
+	s.mu.RLock()
+	c, ok := s.clients[id]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// DisconnectAll disconnects the clients matching the filter forcibly and returns the number of them.
+func (cm *ClientManager) DisconnectAll(filter Filter) int {
+	clients := make([]Client, 0)
+	cm.eachClient(func(c Client) {
+		if filter.Match(c.connection()) {
+			clients = append(clients, c)
+		}
+	})
+
+	for _, c := range clients {
+		c.Close()
+	}
+	return len(clients)
+}
+
+// sortConnections sorts connections by the connected time.
+func sortConnections(connections []Connection) {
+	sort.Slice(connections, func(i, j int) bool {
+		if connections[i].ConnectedAt.Equal(connections[j].ConnectedAt) {
+			// NOTE: IDs are sequential numbers
+			if len(connections[i].ID) != len(connections[j].ID) {
+				return len(connections[i].ID) < len(connections[j].ID)
+			}
+			return connections[i].ID < connections[j].ID
+		}
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+}
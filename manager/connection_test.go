@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/openfresh/plasma/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	cm := NewClientManager()
+	sse := NewClientWithInfo([]string{"program:1234:views"}, ClientInfo{
+		Transport:  "sse",
+		RemoteAddr: "192.0.2.1",
+		UserAgent:  "test",
+		Subject:    "user-1",
+	})
+	grpc := NewClientWithInfo([]string{"program:1234", "program:5678"}, ClientInfo{
+		Transport:  "grpc",
+		RemoteAddr: "192.0.2.2",
+	})
+	cm.AddClient(sse)
+	cm.AddClient(grpc)
+	sse.payloadChan <- event.Payload{Meta: event.MetaData{Type: "program:1234:views"}}
+
+	cases := []struct {
+		filter Filter
+		expect []string
+	}{
+		{filter: Filter{}, expect: []string{sse.ID(), grpc.ID()}},
+		{filter: Filter{Transport: "grpc"}, expect: []string{grpc.ID()}},
+		{filter: Filter{RemoteAddr: "192.0.2.1"}, expect: []string{sse.ID()}},
+		{filter: Filter{Subject: "user-1"}, expect: []string{sse.ID()}},
+		{filter: Filter{Event: "program:5678"}, expect: []string{grpc.ID()}},
+		{filter: Filter{Event: "program"}, expect: []string{}},
+	}
+
+	for _, c := range cases {
+		ids := make([]string, 0)
+		for _, conn := range cm.Connections(c.filter) {
+			ids = append(ids, conn.ID)
+		}
+		assert.Equal(c.expect, ids, "%+v", c.filter)
+	}
+
+	conn := cm.Connections(Filter{Transport: "sse"})[0]
+	assert.Equal("192.0.2.1", conn.RemoteAddr)
+	assert.Equal("test", conn.UserAgent)
+	assert.Equal([]string{"program:1234:views"}, conn.Events)
+	assert.Equal(1, conn.QueueDepth)
+	assert.False(conn.ConnectedAt.IsZero())
+
+	cm.RemoveClient(grpc)
+	assert.Len(cm.Connections(Filter{}), 1)
+}
+
+func TestSubscribers(t *testing.T) {
+	assert := assert.New(t)
+
+	cm := NewClientManager()
+	parent := NewClient([]string{"program:1234"})
+	child := NewClient([]string{"program:1234:views"})
+	other := NewClient([]string{"program:1234:poll"})
+	for _, c := range []Client{parent, child, other} {
+		cm.AddClient(c)
+	}
+
+	ids := make([]string, 0)
+	for _, conn := range cm.Subscribers("program:1234:views") {
+		ids = append(ids, conn.ID)
+	}
+	assert.Equal([]string{parent.ID(), child.ID()}, ids)
+
+	assert.Len(cm.Subscribers("program:5678"), 0)
+}
+
+func TestDisconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	cm := NewClientManager()
+	c1 := NewClientWithInfo([]string{"program:1234"}, ClientInfo{Transport: "sse"})
+	c2 := NewClientWithInfo([]string{"program:1234"}, ClientInfo{Transport: "sse"})
+	c3 := NewClientWithInfo([]string{"program:1234"}, ClientInfo{Transport: "grpc"})
+	for _, c := range []Client{c1, c2, c3} {
+		cm.AddClient(c)
+	}
+
+	assert.True(cm.Disconnect(c1.ID()))
+	assert.True(c1.isClosed())
+	assert.False(cm.Disconnect("unknown"))
+
+	assert.Equal(2, cm.DisconnectAll(Filter{Transport: "sse"}))
+	assert.True(c2.isClosed())
+	assert.False(c3.isClosed())
+
+	// NOTE: the transport removes the disconnected client
+	cm.RemoveClient(c1)
+	cm.RemoveClient(c2)
+	// a removed client isn't added again
+	cm.AddClient(c1)
+	assert.Len(cm.Connections(Filter{}), 1)
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"time"
+)
+
+// NodeStats is the snapshot of a node which is shared with the other nodes of the cluster.
+type NodeStats struct {
+	ID              string           `json:"id"`
+	StartedAt       int64            `json:"started_at"`
+	UpdatedAt       int64            `json:"updated_at"`
+	Connections     int64            `json:"connections"`
+	ConnectionsSSE  int64            `json:"connections_sse"`
+	ConnectionsGRPC int64            `json:"connections_grpc"`
+	Subscribers     map[string]int64 `json:"subscribers"`
+	// NOTE: Presence counts the exact event types tracked by presence, which aren't rolled up
+	Presence map[string]int64 `json:"presence,omitempty"`
+}
+
+// ClusterStats is the sum of the live nodes of the cluster.
+type ClusterStats struct {
+	Time            int64            `json:"time"`
+	NodeNum         int              `json:"node_num"`
+	Connections     int64            `json:"connections"`
+	ConnectionsSSE  int64            `json:"connections_sse"`
+	ConnectionsGRPC int64            `json:"connections_grpc"`
+	Subscribers     map[string]int64 `json:"subscribers"`
+	Nodes           []NodeStats      `json:"nodes"`
+}
+
+// GetNodeStats returns the current stats of this node. The subscribers are counted by the rolled-up event types.
+func GetNodeStats(id string, startedAt time.Time) NodeStats {
+	subscribers := make(map[string]int64)
+	for e, s := range GetEventStats().EventTypes {
+		// NOTE: skip event types which had subscribers once to keep the record small
+		if s.Subscribers > 0 {
+			subscribers[e] = s.Subscribers
+		}
+	}
+	return NodeStats{
+		ID:              id,
+		StartedAt:       startedAt.UnixNano(),
+		UpdatedAt:       time.Now().UnixNano(),
+		Connections:     GetConnection(),
+		ConnectionsSSE:  GetConnectionSSE(),
+		ConnectionsGRPC: GetConnectionGRPC(),
+		Subscribers:     subscribers,
+	}
+}
+
+// NewClusterStats sums the stats of the nodes. The nodes are sorted by ID.
+func NewClusterStats(nodes []NodeStats) *ClusterStats {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	s := &ClusterStats{
+		Time:        time.Now().UnixNano(),
+		NodeNum:     len(nodes),
+		Subscribers: make(map[string]int64),
+		Nodes:       nodes,
+	}
+	for _, n := range nodes {
+		s.Connections += n.Connections
+		s.ConnectionsSSE += n.ConnectionsSSE
+		s.ConnectionsGRPC += n.ConnectionsGRPC
+		for e, v := range n.Subscribers {
+			s.Subscribers[e] += v
+		}
+	}
+	return s
+}
+
+func subscriberSamples(subscribers map[string]int64) []sample {
+	stats := make(map[string]EventTypeStats, len(subscribers))
+	for e, v := range subscribers {
+		stats[e] = EventTypeStats{Subscribers: v}
+	}
+	return eventTypeSamples(stats, func(s EventTypeStats) int64 { return s.Subscribers })
+}
+
+// WriteClusterPrometheus writes the cluster stats in the Prometheus text exposition format.
+func WriteClusterPrometheus(w io.Writer, s *ClusterStats) error {
+	p := prometheusWriter{w: bufio.NewWriter(w)}
+
+	nodes := make([]sample, len(s.Nodes))
+	for i, n := range s.Nodes {
+		nodes[i] = sample{
+			labels: `node="` + labelValueReplacer.Replace(n.ID) + `"`,
+			value:  float64(n.Connections),
+		}
+	}
+	p.write("plasma_cluster_nodes", gauge, "Number of live nodes in the cluster.", value(float64(s.NodeNum)))
+	p.write("plasma_cluster_connections", gauge, "Number of connected clients in the cluster.",
+		transport("sse", s.ConnectionsSSE),
+		transport("grpc", s.ConnectionsGRPC),
+	)
+	p.write("plasma_cluster_node_connections", gauge, "Number of connected clients by node.", nodes...)
+	p.write("plasma_cluster_event_subscribers", gauge, "Number of subscribers in the cluster by event type.",
+		subscriberSamples(s.Subscribers)...)
+	return p.w.Flush()
+}
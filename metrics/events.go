@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+)
+
+// OtherEventType aggregates event types over the cardinality limit.
+const OtherEventType = "_other"
+
+const eventSeparator = ":"
+
+type EventTypeStats struct {
+	Subscribers int64 `json:"subscribers"`
+	Published   int64 `json:"published"`
+	Delivered   int64 `json:"delivered"`
+	BytesSent   int64 `json:"bytes_sent"`
+}
+
+type EventStats struct {
+	Time       int64                     `json:"time"`
+	EventTypes map[string]EventTypeStats `json:"event_types"`
+}
+
+// eventTypeStats tracks traffic per event type. Event types are rolled up to the first depth segments,
+// and event types over max are aggregated into OtherEventType to bound the cardinality.
+// Keys without subscribers are evicted to track new keys, so that max bounds the live cardinality.
+// A zero value of max or depth means unlimited.
+type eventTypeStats struct {
+	mu    sync.Mutex
+	max   int
+	depth int
+	stats map[string]*EventTypeStats
+	// idle holds the keys without subscribers, which can be evicted
+	idle map[string]struct{}
+	// subscribed pins the key which the subscribers of an event type are counted in, so that they are
+	// decremented from the same key even if the key of the event type is changed by eviction or reload
+	subscribed map[string]*subscription
+}
+
+type subscription struct {
+	key   string
+	count int64
+}
+
+func newEventTypeStats(max, depth int) *eventTypeStats {
+	return &eventTypeStats{
+		max:        max,
+		depth:      depth,
+		stats:      make(map[string]*EventTypeStats),
+		idle:       make(map[string]struct{}),
+		subscribed: make(map[string]*subscription),
+	}
+}
+
+var eventTypes = newEventTypeStats(1000, 2)
+
+// SetEventTypeConfig changes the cardinality limit and the roll-up depth of new keys.
+// The current stats are kept not to lose the subscribers of the connected clients.
+func SetEventTypeConfig(config config.EventTypeMetrics) {
+	eventTypes.mu.Lock()
+	defer eventTypes.mu.Unlock()
+	eventTypes.max = config.Max
+	eventTypes.depth = config.Depth
+	for eventTypes.max > 0 && len(eventTypes.stats) > eventTypes.max {
+		if !eventTypes.evict() {
+			break
+		}
+	}
+}
+
+// rollUp returns the ancestor of the event type in the depth.
+// ex) "program:1234:views" is rolled up to "program:1234" if the depth is 2
+func (s *eventTypeStats) rollUp(eventType string) string {
+	if s.depth <= 0 {
+		return eventType
+	}
+	idx := 0
+	for i := 0; i < s.depth; i++ {
+		next := strings.Index(eventType[idx:], eventSeparator)
+		if next < 0 {
+			return eventType
+		}
+		idx += next + 1
+	}
+	return eventType[:idx-1]
+}
+
+// evict removes a key without subscribers. It returns false if all keys have subscribers.
+func (s *eventTypeStats) evict() bool {
+	for key := range s.idle {
+		delete(s.idle, key)
+		delete(s.stats, key)
+		return true
+	}
+	return false
+}
+
+// key returns the key of the event type, which is added if it isn't tracked yet.
+func (s *eventTypeStats) key(eventType string) string {
+	if sub, ok := s.subscribed[eventType]; ok {
+		return sub.key
+	}
+	key := s.rollUp(eventType)
+	if _, ok := s.stats[key]; ok {
+		return key
+	}
+	if s.max > 0 && len(s.stats) >= s.max && !s.evict() {
+		key = OtherEventType
+	}
+	return key
+}
+
+// update adds subscribers to the stats of the event type, and applies f if it isn't nil.
+func (s *eventTypeStats) update(eventType string, subscribers int64, f func(*EventTypeStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, pinned := s.subscribed[eventType]
+	// NOTE: the subscribers which aren't counted can't be decremented
+	if subscribers < 0 && !pinned {
+		return
+	}
+	key := s.key(eventType)
+	st, ok := s.stats[key]
+	if !ok {
+		st = &EventTypeStats{}
+		s.stats[key] = st
+	}
+
+	if subscribers != 0 {
+		if !pinned {
+			sub = &subscription{key: key}
+			s.subscribed[eventType] = sub
+		}
+		sub.count += subscribers
+		if sub.count <= 0 {
+			delete(s.subscribed, eventType)
+		}
+		st.Subscribers += subscribers
+	}
+	if f != nil {
+		f(st)
+	}
+
+	if key == OtherEventType {
+		return
+	}
+	if st.Subscribers > 0 {
+		delete(s.idle, key)
+	} else {
+		s.idle[key] = struct{}{}
+	}
+}
+
+func IncEventSubscriber(eventType string) {
+	eventTypes.update(eventType, 1, nil)
+}
+
+func DecEventSubscriber(eventType string) {
+	eventTypes.update(eventType, -1, nil)
+}
+
+func IncEventPublished(eventType string) {
+	eventTypes.update(eventType, 0, func(s *EventTypeStats) { s.Published++ })
+}
+
+// AddEventDelivered counts a payload delivered to a client and the bytes written.
+func AddEventDelivered(eventType string, bytes int) {
+	eventTypes.update(eventType, 0, func(s *EventTypeStats) {
+		s.Delivered++
+		s.BytesSent += int64(bytes)
+	})
+}
+
+func GetEventStats() *EventStats {
+	eventTypes.mu.Lock()
+	defer eventTypes.mu.Unlock()
+
+	stats := make(map[string]EventTypeStats, len(eventTypes.stats))
+	for k, v := range eventTypes.stats {
+		stats[k] = *v
+	}
+	return &EventStats{
+		Time:       time.Now().UnixNano(),
+		EventTypes: stats,
+	}
+}
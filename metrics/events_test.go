@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/openfresh/plasma/config"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollUp(t *testing.T) {
+	cases := []struct {
+		depth     int
+		eventType string
+		expect    string
+	}{
+		{depth: 2, eventType: "program:1234:views", expect: "program:1234"},
+		{depth: 2, eventType: "program:1234", expect: "program:1234"},
+		{depth: 2, eventType: "program", expect: "program"},
+		{depth: 1, eventType: "program:1234:views", expect: "program"},
+		{depth: 0, eventType: "program:1234:views", expect: "program:1234:views"},
+	}
+
+	for _, c := range cases {
+		s := eventTypeStats{depth: c.depth}
+		assert.Equal(t, c.expect, s.rollUp(c.eventType))
+	}
+}
+
+// resetEventTypeStats replaces the global stats, and returns the function to restore them.
+func resetEventTypeStats(max, depth int) func() {
+	s := eventTypes
+	eventTypes = newEventTypeStats(max, depth)
+	return func() {
+		eventTypes = s
+	}
+}
+
+func TestEventStats(t *testing.T) {
+	assert := assert.New(t)
+
+	defer resetEventTypeStats(2, 2)()
+
+	IncEventSubscriber("program:1234")
+	IncEventSubscriber("program:1234:views")
+	DecEventSubscriber("program:1234")
+	IncEventPublished("program:1234:views")
+	AddEventDelivered("program:1234:views", 10)
+	AddEventDelivered("program:1234:poll", 20)
+	IncEventSubscriber("program:5678")
+	// over the cardinality limit
+	IncEventSubscriber("user:1")
+	IncEventPublished("user:2")
+
+	s := GetEventStats()
+	assert.Equal(map[string]EventTypeStats{
+		"program:1234": {Subscribers: 1, Published: 1, Delivered: 2, BytesSent: 30},
+		"program:5678": {Subscribers: 1},
+		OtherEventType: {Subscribers: 1, Published: 1},
+	}, s.EventTypes)
+}
+
+func TestEventStatsEvict(t *testing.T) {
+	assert := assert.New(t)
+
+	defer resetEventTypeStats(2, 2)()
+
+	IncEventSubscriber("program:1")
+	IncEventSubscriber("program:2")
+	IncEventSubscriber("program:3")
+	assert.Equal(int64(1), GetEventStats().EventTypes[OtherEventType].Subscribers)
+
+	// NOTE: the key without subscribers is evicted for a new key
+	DecEventSubscriber("program:1")
+	IncEventSubscriber("program:4")
+	s := GetEventStats()
+	assert.Equal(map[string]EventTypeStats{
+		"program:2":    {Subscribers: 1},
+		"program:4":    {Subscribers: 1},
+		OtherEventType: {Subscribers: 1},
+	}, s.EventTypes)
+
+	// NOTE: the subscribers are decremented from the key which they are counted in
+	DecEventSubscriber("program:3")
+	DecEventSubscriber("program:3")
+	assert.Equal(int64(0), GetEventStats().EventTypes[OtherEventType].Subscribers)
+}
+
+func TestSetEventTypeConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	defer resetEventTypeStats(1000, 2)()
+
+	IncEventSubscriber("program:1234:views")
+	IncEventPublished("program:5678")
+
+	// NOTE: the subscribers of the connected clients are kept, and idle keys are evicted over the new limit
+	SetEventTypeConfig(config.EventTypeMetrics{Max: 1, Depth: 3})
+	assert.Equal(map[string]EventTypeStats{
+		"program:1234": {Subscribers: 1},
+	}, GetEventStats().EventTypes)
+
+	IncEventSubscriber("program:1234:views")
+	DecEventSubscriber("program:1234:views")
+	DecEventSubscriber("program:1234:views")
+	assert.Equal(int64(0), GetEventStats().EventTypes["program:1234"].Subscribers)
+}
+
+func TestUpdateEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &Metrics{}
+	m.updateEvents(&EventStats{EventTypes: map[string]EventTypeStats{
+		"gauge-test:1": {Subscribers: 1},
+		"gauge-test:2": {Subscribers: 2},
+	}})
+	assert.NotNil(metrics.Get("EventType.gauge-test.1.Subscribers"))
+	assert.NotNil(metrics.Get("EventType.gauge-test.2.BytesSent"))
+
+	// NOTE: the gauges of the evicted event types are unregistered
+	m.updateEvents(&EventStats{EventTypes: map[string]EventTypeStats{
+		"gauge-test:2": {Subscribers: 1},
+	}})
+	assert.Nil(metrics.Get("EventType.gauge-test.1.Subscribers"))
+	assert.Nil(metrics.Get("EventType.gauge-test.1.BytesSent"))
+	assert.Equal(int64(1), metrics.Get("EventType.gauge-test.2.Subscribers").(metrics.Gauge).Value())
+
+	m.updateEvents(&EventStats{})
+	assert.Nil(metrics.Get("EventType.gauge-test.2.Subscribers"))
+}
@@ -22,3 +22,12 @@ func PlasmaStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func EventStatsHandler(w http.ResponseWriter, r *http.Request) {
+	s := GetEventStats()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
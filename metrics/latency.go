@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// Delivery latency stages in microseconds.
+// publish-to-ingest: from publishedAt stamped by the publisher to receiving it by the subscriber
+// ingest-to-enqueue: from receiving it by the subscriber to enqueuing it to clients
+// enqueue-to-write: from enqueuing it to writing it to the SSE or gRPC stream
+var (
+	publishToIngest = newLatencyHistogram()
+	ingestToEnqueue = newLatencyHistogram()
+	enqueueToWrite  = newLatencyHistogram()
+)
+
+type latencyStage struct {
+	name      string
+	histogram metrics.Histogram
+}
+
+var latencyStages = []latencyStage{
+	{name: "publish_to_ingest", histogram: publishToIngest},
+	{name: "ingest_to_enqueue", histogram: ingestToEnqueue},
+	{name: "enqueue_to_write", histogram: enqueueToWrite},
+}
+
+func newLatencyHistogram() metrics.Histogram {
+	return metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+}
+
+var latencyPercentiles = []float64{0.5, 0.95, 0.99}
+
+type LatencyStats struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean_us"`
+	P50   float64 `json:"p50_us"`
+	P95   float64 `json:"p95_us"`
+	P99   float64 `json:"p99_us"`
+	Max   int64   `json:"max_us"`
+}
+
+func observe(h metrics.Histogram, d time.Duration) {
+	// NOTE: publishedAt can be ahead of the clock of plasma
+	if d < 0 {
+		d = 0
+	}
+	h.Update(int64(d / time.Microsecond))
+}
+
+func ObservePublishToIngest(d time.Duration) {
+	observe(publishToIngest, d)
+}
+
+func ObserveIngestToEnqueue(d time.Duration) {
+	observe(ingestToEnqueue, d)
+}
+
+func ObserveEnqueueToWrite(d time.Duration) {
+	observe(enqueueToWrite, d)
+}
+
+func getLatencyStats(h metrics.Histogram) LatencyStats {
+	s := h.Snapshot()
+	ps := s.Percentiles(latencyPercentiles)
+	return LatencyStats{
+		Count: s.Count(),
+		Mean:  s.Mean(),
+		P50:   ps[0],
+		P95:   ps[1],
+		P99:   ps[2],
+		Max:   s.Max(),
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/openfresh/plasma/config"
@@ -9,9 +11,15 @@ import (
 )
 
 type Metrics struct {
-	ticker *time.Ticker
-	config config.Metrics
-	sender sender.MetricsSender
+	mu      sync.Mutex
+	ticker  *time.Ticker
+	done    chan struct{}
+	running bool
+	config  config.Metrics
+	sender  sender.MetricsSender
+	// eventGauges holds the names of the gauges registered per event type
+	eventGauges   map[string]struct{}
+	eventGaugesMu sync.Mutex
 
 	GcLast metrics.Gauge
 	GcNext metrics.Gauge
@@ -37,6 +45,17 @@ type Metrics struct {
 	Connections     metrics.Gauge
 	ConnectionsSSE  metrics.Gauge
 	ConnectionsGRPC metrics.Gauge
+
+	TLSCertDaysUntilExpiry metrics.Gauge
+	ConnectionsRejected    metrics.Gauge
+	ConnectionsRateLimited metrics.Gauge
+	ConnectsSSE            metrics.Gauge
+	ConnectsGRPC           metrics.Gauge
+	DisconnectsSSE         metrics.Gauge
+	DisconnectsGRPC        metrics.Gauge
+	PayloadsReceived       metrics.Gauge
+	PayloadsDelivered      metrics.Gauge
+	PayloadsDropped        metrics.Gauge
 }
 
 func NewMetrics(config config.Config) (*Metrics, error) {
@@ -61,6 +80,17 @@ func NewMetrics(config config.Config) (*Metrics, error) {
 		Connections:      metrics.NewGauge(),
 		ConnectionsSSE:   metrics.NewGauge(),
 		ConnectionsGRPC:  metrics.NewGauge(),
+
+		TLSCertDaysUntilExpiry: metrics.NewGauge(),
+		ConnectionsRejected:    metrics.NewGauge(),
+		ConnectionsRateLimited: metrics.NewGauge(),
+		ConnectsSSE:            metrics.NewGauge(),
+		ConnectsGRPC:           metrics.NewGauge(),
+		DisconnectsSSE:         metrics.NewGauge(),
+		DisconnectsGRPC:        metrics.NewGauge(),
+		PayloadsReceived:       metrics.NewGauge(),
+		PayloadsDelivered:      metrics.NewGauge(),
+		PayloadsDropped:        metrics.NewGauge(),
 	}
 
 	if err := metrics.Register("GcLast", m.GcLast); err != nil {
@@ -120,33 +150,123 @@ func NewMetrics(config config.Config) (*Metrics, error) {
 	if err := metrics.Register("ConnectionsGRPC", m.ConnectionsGRPC); err != nil {
 		return m, err
 	}
+	if err := metrics.Register("TLSCertDaysUntilExpiry", m.TLSCertDaysUntilExpiry); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("ConnectionsRejected", m.ConnectionsRejected); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("ConnectionsRateLimited", m.ConnectionsRateLimited); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("ConnectsSSE", m.ConnectsSSE); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("ConnectsGRPC", m.ConnectsGRPC); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("DisconnectsSSE", m.DisconnectsSSE); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("DisconnectsGRPC", m.DisconnectsGRPC); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("PayloadsReceived", m.PayloadsReceived); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("PayloadsDelivered", m.PayloadsDelivered); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("PayloadsDropped", m.PayloadsDropped); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("PublishToIngest", publishToIngest); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("IngestToEnqueue", ingestToEnqueue); err != nil {
+		return m, err
+	}
+	if err := metrics.Register("EnqueueToWrite", enqueueToWrite); err != nil {
+		return m, err
+	}
 
 	sender, err := sender.NewMetricsSender(m.config)
 	if err != nil {
 		return m, err
 	}
 	m.sender = sender
-	m.ticker = time.NewTicker(m.config.Interval)
 
 	return m, nil
 }
 
 func (m *Metrics) Start() {
-	go func() {
-		for range m.ticker.C {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start()
+}
+
+func (m *Metrics) start() {
+	if m.running || m.sender == nil {
+		return
+	}
+	m.running = true
+	m.ticker = time.NewTicker(m.config.Interval)
+	m.done = make(chan struct{})
+	go m.update(m.ticker, m.done)
+	go m.sender.Send()
+}
+
+func (m *Metrics) update(ticker *time.Ticker, done chan struct{}) {
+	for {
+		select {
+		case <-ticker.C:
 			gs := GetGoStats()
 			m.updateGo(gs)
 
 			ps := GetPlasmaStats()
 			m.updatePlasma(ps)
-		}
-	}()
 
-	go m.sender.Send()
+			es := GetEventStats()
+			m.updateEvents(es)
+		case <-done:
+			return
+		}
+	}
 }
 
 func (m *Metrics) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stop()
+}
+
+func (m *Metrics) stop() {
+	if !m.running {
+		return
+	}
+	m.running = false
 	m.ticker.Stop()
+	close(m.done)
+	m.sender.Stop()
+}
+
+// Reload replaces the sender with a new one of the config. Sending is stopped if the type is empty.
+func (m *Metrics) Reload(config config.Metrics) error {
+	var s sender.MetricsSender
+	if config.Type != "" {
+		var err error
+		if s, err = sender.NewMetricsSender(config); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stop()
+	m.config = config
+	m.sender = s
+	m.start()
+	return nil
 }
 
 func (m *Metrics) updateGo(s *GoStats) {
@@ -172,4 +292,43 @@ func (m *Metrics) updatePlasma(s *PlasmaStats) {
 	m.Connections.Update(s.Connections)
 	m.ConnectionsSSE.Update(s.ConnectionsSSE)
 	m.ConnectionsGRPC.Update(s.ConnectionsGRPC)
+	m.TLSCertDaysUntilExpiry.Update(s.TLSCertDaysUntilExpiry)
+	m.ConnectionsRejected.Update(s.ConnectionsRejected)
+	m.ConnectionsRateLimited.Update(s.ConnectionsRateLimited)
+	m.ConnectsSSE.Update(s.ConnectsSSE)
+	m.ConnectsGRPC.Update(s.ConnectsGRPC)
+	m.DisconnectsSSE.Update(s.DisconnectsSSE)
+	m.DisconnectsGRPC.Update(s.DisconnectsGRPC)
+	m.PayloadsReceived.Update(s.PayloadsReceived)
+	m.PayloadsDelivered.Update(s.PayloadsDelivered)
+	m.PayloadsDropped.Update(s.PayloadsDropped)
+}
+
+var eventGaugeNames = []string{".Subscribers", ".Published", ".Delivered", ".BytesSent"}
+
+// updateEvents registers gauges per event type lazily. ":" is replaced with "." to be used as a name of senders.
+// ex) EventType.program.1234.Subscribers
+// The gauges of the evicted event types are unregistered not to grow the registry.
+func (m *Metrics) updateEvents(s *EventStats) {
+	m.eventGaugesMu.Lock()
+	defer m.eventGaugesMu.Unlock()
+
+	names := make(map[string]struct{}, len(s.EventTypes))
+	for eventType, st := range s.EventTypes {
+		name := "EventType." + strings.Replace(eventType, eventSeparator, ".", -1)
+		names[name] = struct{}{}
+		metrics.GetOrRegisterGauge(name+".Subscribers", nil).Update(st.Subscribers)
+		metrics.GetOrRegisterGauge(name+".Published", nil).Update(st.Published)
+		metrics.GetOrRegisterGauge(name+".Delivered", nil).Update(st.Delivered)
+		metrics.GetOrRegisterGauge(name+".BytesSent", nil).Update(st.BytesSent)
+	}
+	for name := range m.eventGauges {
+		if _, ok := names[name]; ok {
+			continue
+		}
+		for _, n := range eventGaugeNames {
+			metrics.Unregister(name + n)
+		}
+	}
+	m.eventGauges = names
 }
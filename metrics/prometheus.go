@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	counter = "counter"
+	gauge   = "gauge"
+	summary = "summary"
+)
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+// prometheusWriter writes metrics in the Prometheus text exposition format.
+type prometheusWriter struct {
+	w *bufio.Writer
+}
+
+func (p prometheusWriter) write(name, typ, help string, samples ...sample) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(p.w, "# TYPE %s %s\n", name, typ)
+	for _, s := range samples {
+		p.w.WriteString(name)
+		if s.labels != "" {
+			p.w.WriteString("{" + s.labels + "}")
+		}
+		p.w.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+	}
+}
+
+// writeLatency writes latency histograms in microseconds as a summary in seconds.
+func (p prometheusWriter) writeLatency(name, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(p.w, "# TYPE %s %s\n", name, summary)
+	for _, stage := range latencyStages {
+		s := stage.histogram.Snapshot()
+		label := `stage="` + stage.name + `"`
+		for i, v := range s.Percentiles(latencyPercentiles) {
+			q := strconv.FormatFloat(latencyPercentiles[i], 'g', -1, 64)
+			fmt.Fprintf(p.w, "%s{%s,quantile=\"%s\"} %s\n", name, label, q, strconv.FormatFloat(v/1e6, 'g', -1, 64))
+		}
+		fmt.Fprintf(p.w, "%s_sum{%s} %s\n", name, label, strconv.FormatFloat(float64(s.Sum())/1e6, 'g', -1, 64))
+		fmt.Fprintf(p.w, "%s_count{%s} %d\n", name, label, s.Count())
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func eventTypeSamples(stats map[string]EventTypeStats, f func(EventTypeStats) int64) []sample {
+	eventTypes := make([]string, 0, len(stats))
+	for e := range stats {
+		eventTypes = append(eventTypes, e)
+	}
+	sort.Strings(eventTypes)
+
+	samples := make([]sample, len(eventTypes))
+	for i, e := range eventTypes {
+		samples[i] = sample{
+			labels: `event_type="` + labelValueReplacer.Replace(e) + `"`,
+			value:  float64(f(stats[e])),
+		}
+	}
+	return samples
+}
+
+func value(v float64) sample {
+	return sample{value: v}
+}
+
+func transport(t string, v int64) sample {
+	return sample{labels: `transport="` + t + `"`, value: float64(v)}
+}
+
+func writeGoMetrics(p prometheusWriter) {
+	// NOTE: GetGoStats isn't used here because it updates the state to calculate rates for the sender
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	p.write("go_info", gauge, "Information about the Go environment.",
+		sample{labels: `version="` + runtime.Version() + `"`, value: 1})
+	p.write("go_goroutines", gauge, "Number of goroutines that currently exist.", value(float64(runtime.NumGoroutine())))
+	p.write("go_gomaxprocs", gauge, "Value of GOMAXPROCS.", value(float64(runtime.GOMAXPROCS(0))))
+	p.write("go_memstats_alloc_bytes", gauge, "Number of bytes allocated and still in use.", value(float64(mem.Alloc)))
+	p.write("go_memstats_alloc_bytes_total", counter, "Total number of bytes allocated, even if freed.", value(float64(mem.TotalAlloc)))
+	p.write("go_memstats_sys_bytes", gauge, "Number of bytes obtained from system.", value(float64(mem.Sys)))
+	p.write("go_memstats_lookups_total", counter, "Total number of pointer lookups.", value(float64(mem.Lookups)))
+	p.write("go_memstats_mallocs_total", counter, "Total number of mallocs.", value(float64(mem.Mallocs)))
+	p.write("go_memstats_frees_total", counter, "Total number of frees.", value(float64(mem.Frees)))
+	p.write("go_memstats_heap_alloc_bytes", gauge, "Number of heap bytes allocated and still in use.", value(float64(mem.HeapAlloc)))
+	p.write("go_memstats_heap_sys_bytes", gauge, "Number of heap bytes obtained from system.", value(float64(mem.HeapSys)))
+	p.write("go_memstats_heap_idle_bytes", gauge, "Number of heap bytes waiting to be used.", value(float64(mem.HeapIdle)))
+	p.write("go_memstats_heap_inuse_bytes", gauge, "Number of heap bytes that are in use.", value(float64(mem.HeapInuse)))
+	p.write("go_memstats_heap_released_bytes", gauge, "Number of heap bytes released to OS.", value(float64(mem.HeapReleased)))
+	p.write("go_memstats_heap_objects", gauge, "Number of allocated objects.", value(float64(mem.HeapObjects)))
+	p.write("go_memstats_stack_inuse_bytes", gauge, "Number of bytes in use by the stack allocator.", value(float64(mem.StackInuse)))
+	p.write("go_memstats_next_gc_bytes", gauge, "Number of heap bytes when next garbage collection will take place.", value(float64(mem.NextGC)))
+	p.write("go_memstats_last_gc_time_seconds", gauge, "Number of seconds since 1970 of last garbage collection.", value(float64(mem.LastGC)/1e9))
+	p.write("go_gc_cycles_total", counter, "Number of completed GC cycles.", value(float64(mem.NumGC)))
+	p.write("go_gc_pause_seconds_total", counter, "Total GC pause time in seconds.", value(float64(mem.PauseTotalNs)/1e9))
+}
+
+func writePlasmaMetrics(p prometheusWriter) {
+	s := GetPlasmaStats()
+
+	p.write("plasma_connections", gauge, "Number of connected clients.",
+		transport("sse", s.ConnectionsSSE),
+		transport("grpc", s.ConnectionsGRPC),
+	)
+	p.write("plasma_connects_total", counter, "Total number of accepted connections.",
+		transport("sse", s.ConnectsSSE),
+		transport("grpc", s.ConnectsGRPC),
+	)
+	p.write("plasma_disconnects_total", counter, "Total number of closed connections.",
+		transport("sse", s.DisconnectsSSE),
+		transport("grpc", s.DisconnectsGRPC),
+	)
+	p.write("plasma_connections_rejected_total", counter, "Total number of connections rejected by the connection limits.", value(float64(s.ConnectionsRejected)))
+	p.write("plasma_connections_rate_limited_total", counter, "Total number of connect attempts rejected by the rate limit.", value(float64(s.ConnectionsRateLimited)))
+	p.write("plasma_payloads_received_total", counter, "Total number of payloads received from the subscriber.", value(float64(s.PayloadsReceived)))
+	p.write("plasma_payloads_delivered_total", counter, "Total number of payloads written to clients.", value(float64(s.PayloadsDelivered)))
+	p.write("plasma_payloads_dropped_total", counter, "Total number of payloads which couldn't be written to clients.", value(float64(s.PayloadsDropped)))
+	p.writeLatency("plasma_delivery_latency_seconds", "Latency of delivering payloads by stage.")
+
+	es := GetEventStats().EventTypes
+	p.write("plasma_event_subscribers", gauge, "Number of subscribers by event type.",
+		eventTypeSamples(es, func(s EventTypeStats) int64 { return s.Subscribers })...)
+	p.write("plasma_event_published_total", counter, "Total number of payloads published by event type.",
+		eventTypeSamples(es, func(s EventTypeStats) int64 { return s.Published })...)
+	p.write("plasma_event_delivered_total", counter, "Total number of payloads delivered by event type.",
+		eventTypeSamples(es, func(s EventTypeStats) int64 { return s.Delivered })...)
+	p.write("plasma_event_sent_bytes_total", counter, "Total bytes sent to clients by event type.",
+		eventTypeSamples(es, func(s EventTypeStats) int64 { return s.BytesSent })...)
+
+	p.write("plasma_tls_cert_expiry_timestamp_seconds", gauge, "Unix time when the current TLS certificate expires. 0 if TLS is disabled.", value(float64(GetTLSCertExpiry())))
+}
+
+// WritePrometheus writes Go and plasma metrics in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer) error {
+	p := prometheusWriter{w: bufio.NewWriter(w)}
+	writeGoMetrics(p)
+	writePlasmaMetrics(p)
+	return p.w.Flush()
+}
+
+func PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	if err := WritePrometheus(w); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -6,20 +6,25 @@ import (
 	"os"
 
 	"github.com/openfresh/plasma/config"
-	"github.com/pkg/errors"
+	plog "github.com/openfresh/plasma/log"
 	metrics "github.com/rcrowley/go-metrics"
 )
 
 const Log = "log"
 
 type logSender struct {
-	logger metrics.Logger
-	config config.LogMetrics
+	logger   metrics.Logger
+	config   config.LogMetrics
+	registry metrics.Registry
+	file     *plog.File
+	loop     *loop
 }
 
-func newLogSender(config config.LogMetrics) (logSender, error) {
-	sender := logSender{
-		config: config,
+func newLogSender(config config.LogMetrics) (*logSender, error) {
+	sender := &logSender{
+		config:   config,
+		registry: metrics.DefaultRegistry,
+		loop:     newLoop(),
 	}
 
 	var writer io.Writer
@@ -30,11 +35,12 @@ func newLogSender(config config.LogMetrics) (logSender, error) {
 	case "stderr":
 		writer = os.Stderr
 	default:
-		w, err := os.OpenFile(config.Out, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		w, err := plog.OpenFile(config.Out, config.Rotate)
 		if err != nil {
-			return sender, errors.Wrapf(err, "failed to open file: %s", config.Out)
+			return nil, err
 		}
 		writer = w
+		sender.file = w
 	}
 
 	sender.logger = log.New(writer, config.Prefix, config.Flag)
@@ -42,6 +48,27 @@ func newLogSender(config config.LogMetrics) (logSender, error) {
 	return sender, nil
 }
 
-func (s logSender) Send() {
-	metrics.Log(metrics.DefaultRegistry, s.config.Interval, s.logger)
+func (s *logSender) Send() {
+	s.loop.run(s.config.Interval, s.write)
+	if s.file != nil {
+		s.file.Close()
+	}
+}
+
+func (s *logSender) Stop() {
+	s.loop.stop()
+}
+
+// write logs each line written by go-metrics.
+func (s *logSender) write() {
+	metrics.WriteOnce(s.registry, loggerWriter{s.logger})
+}
+
+type loggerWriter struct {
+	logger metrics.Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Printf("%s", p)
+	return len(p), nil
 }
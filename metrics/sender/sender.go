@@ -2,12 +2,16 @@ package sender
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/openfresh/plasma/config"
 )
 
 type MetricsSender interface {
 	Send()
+	// Stop stops sending. The sender can't be started again.
+	Stop()
 }
 
 func NewMetricsSender(config config.Metrics) (MetricsSender, error) {
@@ -19,9 +23,39 @@ func NewMetricsSender(config config.Metrics) (MetricsSender, error) {
 		metricsSender, err = newLogSender(config.Log)
 	case Syslog:
 		metricsSender, err = newSyslogSender(config.Syslog)
+	case Statsd:
+		metricsSender, err = newStatsdSender(config.Statsd)
 	default:
 		err = fmt.Errorf("unknown metrics sender type: %s", config.Type)
 	}
 
 	return metricsSender, err
 }
+
+// loop runs a function periodically until stop.
+// NOTE: the senders of go-metrics tick forever, so the senders write each round by themselves
+type loop struct {
+	done chan struct{}
+	once sync.Once
+}
+
+func newLoop() *loop {
+	return &loop{done: make(chan struct{})}
+}
+
+func (l *loop) run(interval time.Duration, f func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *loop) stop() {
+	l.once.Do(func() { close(l.done) })
+}
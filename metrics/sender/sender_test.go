@@ -0,0 +1,62 @@
+package sender
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSender(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := newLogSender(config.LogMetrics{Out: "stdout", Interval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	s.logger = log.New(&buf, "", 0)
+	s.registry = metrics.NewRegistry()
+	connections := metrics.NewGauge()
+	connections.Update(3)
+	require.NoError(t, s.registry.Register("Connections", connections))
+
+	s.write()
+	assert.Equal("gauge Connections\n  value:               3\n", buf.String())
+
+	done := make(chan struct{})
+	go func() {
+		s.Send()
+		close(done)
+	}()
+	s.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send didn't return after Stop")
+	}
+	// NOTE: Stop can be called more than once
+	s.Stop()
+}
+
+func TestSyslogRecords(t *testing.T) {
+	registry := metrics.NewRegistry()
+	connections := metrics.NewGauge()
+	connections.Update(3)
+	payloads := metrics.NewCounter()
+	payloads.Inc(5)
+	require.NoError(t, registry.Register("Connections", connections))
+	require.NoError(t, registry.Register("Payloads", payloads))
+
+	s := &syslogSender{registry: registry}
+	assert.Equal(t, []string{
+		"gauge Connections value: 3",
+		"counter Payloads count: 5",
+	}, s.records())
+	assert.Equal(t, 0, s.buf.Len())
+}
@@ -0,0 +1,164 @@
+package sender
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const Statsd = "statsd"
+
+// NOTE: keep a packet within the MTU of the common networks
+const maxPacketSize = 1432
+
+var percentiles = []float64{0.5, 0.95, 0.99}
+
+type statsdSender struct {
+	conn     net.Conn
+	config   config.StatsdMetrics
+	registry metrics.Registry
+	tags     []string
+	// NOTE: last values of counters to send increments
+	counters map[string]int64
+	buf      bytes.Buffer
+	loop     *loop
+}
+
+func newStatsdSender(config config.StatsdMetrics) (*statsdSender, error) {
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial statsd: %s", config.Addr)
+	}
+
+	tags := config.Tags
+	if config.DogStatsD {
+		if node, err := os.Hostname(); err == nil {
+			tags = append([]string{"node:" + node}, tags...)
+		}
+	}
+
+	return &statsdSender{
+		conn:     conn,
+		config:   config,
+		registry: metrics.DefaultRegistry,
+		tags:     tags,
+		counters: make(map[string]int64),
+		loop:     newLoop(),
+	}, nil
+}
+
+func (s *statsdSender) Send() {
+	// NOTE: statsd is fire-and-forget, the next flush will send the latest values
+	s.loop.run(s.config.Interval, func() { s.flush() })
+	s.conn.Close()
+}
+
+func (s *statsdSender) Stop() {
+	s.loop.stop()
+}
+
+// transportSuffixes are split into the transport tag for DogStatsD.
+// ex) ConnectionsSSE is sent as Connections with "transport:sse"
+var transportSuffixes = []string{"SSE", "GRPC"}
+
+func (s *statsdSender) write(name, value, typ string) error {
+	tags := s.tags
+	if s.config.DogStatsD {
+		for _, suffix := range transportSuffixes {
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				name = strings.TrimSuffix(name, suffix)
+				tags = append(tags[:len(tags):len(tags)], "transport:"+strings.ToLower(suffix))
+				break
+			}
+		}
+	}
+
+	line := s.config.Prefix + name + ":" + value + "|" + typ
+	if s.config.DogStatsD && len(tags) != 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	if s.buf.Len() != 0 && s.buf.Len()+len(line)+1 > maxPacketSize {
+		if err := s.send(); err != nil {
+			return err
+		}
+	}
+	if s.buf.Len() != 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteString(line)
+	return nil
+}
+
+func (s *statsdSender) send() error {
+	defer s.buf.Reset()
+	_, err := s.conn.Write(s.buf.Bytes())
+	return err
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sampled is a snapshot of histograms and timers.
+type sampled interface {
+	Count() int64
+	Mean() float64
+	Max() int64
+	Percentiles([]float64) []float64
+}
+
+func (s *statsdSender) writeSample(name string, snapshot sampled) error {
+	if err := s.write(name+".count", strconv.FormatInt(snapshot.Count(), 10), "g"); err != nil {
+		return err
+	}
+	if err := s.write(name+".mean", formatFloat(snapshot.Mean()), "g"); err != nil {
+		return err
+	}
+	if err := s.write(name+".max", strconv.FormatInt(snapshot.Max(), 10), "g"); err != nil {
+		return err
+	}
+	for i, p := range snapshot.Percentiles(percentiles) {
+		if err := s.write(name+".p"+strconv.Itoa(int(percentiles[i]*100)), formatFloat(p), "g"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statsdSender) flush() error {
+	var err error
+	s.registry.Each(func(name string, i interface{}) {
+		if err != nil {
+			return
+		}
+		switch m := i.(type) {
+		case metrics.Gauge:
+			err = s.write(name, strconv.FormatInt(m.Value(), 10), "g")
+		case metrics.GaugeFloat64:
+			err = s.write(name, formatFloat(m.Value()), "g")
+		case metrics.Counter:
+			count := m.Count()
+			err = s.write(name, strconv.FormatInt(count-s.counters[name], 10), "c")
+			s.counters[name] = count
+		case metrics.Histogram:
+			err = s.writeSample(name, m.Snapshot())
+		case metrics.Timer:
+			err = s.writeSample(name, m.Snapshot())
+		}
+	})
+	if err != nil {
+		s.buf.Reset()
+		return err
+	}
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	return s.send()
+}
@@ -0,0 +1,137 @@
+package sender
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listenUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return conn
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) []string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestStatsdSender(t *testing.T) {
+	assert := assert.New(t)
+
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	cases := []struct {
+		config config.StatsdMetrics
+		expect []string
+	}{
+		{
+			config: config.StatsdMetrics{Prefix: "plasma."},
+			expect: []string{
+				"plasma.Connections:3|g",
+				"plasma.ConnectionsSSE:2|g",
+				"plasma.Payloads:5|c",
+			},
+		},
+		{
+			config: config.StatsdMetrics{Prefix: "plasma.", DogStatsD: true, Tags: []string{"env:test"}},
+			expect: []string{
+				"plasma.Connections:2|g|#env:test,transport:sse",
+				"plasma.Connections:3|g|#env:test",
+				"plasma.Payloads:5|c|#env:test",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c.config.Addr = conn.LocalAddr().String()
+		s, err := newStatsdSender(c.config)
+		require.NoError(t, err)
+		// NOTE: the node tag depends on the host
+		s.tags = c.config.Tags
+
+		registry := metrics.NewRegistry()
+		connections := metrics.NewGauge()
+		connections.Update(3)
+		connectionsSSE := metrics.NewGauge()
+		connectionsSSE.Update(2)
+		payloads := metrics.NewCounter()
+		payloads.Inc(5)
+		require.NoError(t, registry.Register("Connections", connections))
+		require.NoError(t, registry.Register("ConnectionsSSE", connectionsSSE))
+		require.NoError(t, registry.Register("Payloads", payloads))
+		s.registry = registry
+
+		require.NoError(t, s.flush())
+		assert.Equal(c.expect, readPacket(t, conn))
+
+		// counters are sent as increments
+		payloads.Inc(1)
+		require.NoError(t, s.flush())
+		assert.Contains(strings.Join(readPacket(t, conn), "\n"), "plasma.Payloads:1|c")
+	}
+}
+
+func TestStatsdSenderSplitPackets(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	s, err := newStatsdSender(config.StatsdMetrics{Addr: conn.LocalAddr().String()})
+	require.NoError(t, err)
+
+	registry := metrics.NewRegistry()
+	for i := 0; i < 200; i++ {
+		require.NoError(t, registry.Register(strings.Repeat("x", 10)+string(rune('a'+i%26))+string(rune('a'+i/26)), metrics.NewGauge()))
+	}
+	s.registry = registry
+	require.NoError(t, s.flush())
+
+	var lines int
+	for lines < 200 {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.True(t, n <= maxPacketSize)
+		lines += len(strings.Split(string(buf[:n]), "\n"))
+	}
+	assert.Equal(t, 200, lines)
+}
+
+func TestStatsdSenderStop(t *testing.T) {
+	conn := listenUDP(t)
+	defer conn.Close()
+
+	s, err := newStatsdSender(config.StatsdMetrics{Addr: conn.LocalAddr().String(), Interval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	s.registry = metrics.NewRegistry()
+
+	done := make(chan struct{})
+	go func() {
+		s.Send()
+		close(done)
+	}()
+	s.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send didn't return after Stop")
+	}
+	// NOTE: Stop can be called more than once, ex) reloading the config during shutdown
+	s.Stop()
+}
@@ -1,7 +1,10 @@
 package sender
 
 import (
+	"bufio"
+	"bytes"
 	"log/syslog"
+	"strings"
 
 	"github.com/openfresh/plasma/config"
 	metrics "github.com/rcrowley/go-metrics"
@@ -10,28 +13,61 @@ import (
 const Syslog = "syslog"
 
 type syslogSender struct {
-	writer *syslog.Writer
-	config config.SyslogMetrics
+	writer   *syslog.Writer
+	config   config.SyslogMetrics
+	registry metrics.Registry
+	loop     *loop
+	buf      bytes.Buffer
 }
 
-func newSyslogSender(config config.SyslogMetrics) (syslogSender, error) {
-	sender := syslogSender{
-		config: config,
-	}
-
-	c := sender.config
-
-	priority := syslog.Priority(c.Severity | c.Facility)
-	writer, err := syslog.Dial(c.Network, c.Addr, priority, c.Tag)
+func newSyslogSender(config config.SyslogMetrics) (*syslogSender, error) {
+	priority := syslog.Priority(config.Severity | config.Facility)
+	writer, err := syslog.Dial(config.Network, config.Addr, priority, config.Tag)
 	if err != nil {
-		return sender, err
+		return nil, err
 	}
 
-	sender.writer = writer
+	return &syslogSender{
+		writer:   writer,
+		config:   config,
+		registry: metrics.DefaultRegistry,
+		loop:     newLoop(),
+	}, nil
+}
+
+func (s *syslogSender) Send() {
+	s.loop.run(s.config.Interval, func() {
+		for _, record := range s.records() {
+			s.writer.Info(record)
+		}
+	})
+	s.writer.Close()
+}
 
-	return sender, nil
+func (s *syslogSender) Stop() {
+	s.loop.stop()
 }
 
-func (s syslogSender) Send() {
-	metrics.Syslog(metrics.DefaultRegistry, s.config.Interval, s.writer)
+// records formats the metrics with one record per metric.
+// ex) "gauge Connections value: 3"
+func (s *syslogSender) records() []string {
+	defer s.buf.Reset()
+	metrics.WriteOnce(s.registry, &s.buf)
+
+	var records []string
+	scanner := bufio.NewScanner(&s.buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Join(strings.Fields(line), " ")
+		if fields == "" {
+			continue
+		}
+		// NOTE: the values of a metric are indented
+		if strings.HasPrefix(line, " ") && len(records) != 0 {
+			records[len(records)-1] += " " + fields
+			continue
+		}
+		records = append(records, fields)
+	}
+	return records
 }
@@ -43,10 +43,23 @@ type GoStats struct {
 }
 
 type PlasmaStats struct {
-	Time            int64 `json:"time"`
-	Connections     int64 `json:"connections"`
-	ConnectionsSSE  int64 `json:"connections_sse"`
-	ConnectionsGRPC int64 `json:"connections_grpc"`
+	Time                   int64        `json:"time"`
+	Connections            int64        `json:"connections"`
+	ConnectionsSSE         int64        `json:"connections_sse"`
+	ConnectionsGRPC        int64        `json:"connections_grpc"`
+	TLSCertDaysUntilExpiry int64        `json:"tls_cert_days_until_expiry"`
+	ConnectionsRejected    int64        `json:"connections_rejected"`
+	ConnectionsRateLimited int64        `json:"connections_rate_limited"`
+	ConnectsSSE            int64        `json:"connects_sse"`
+	ConnectsGRPC           int64        `json:"connects_grpc"`
+	DisconnectsSSE         int64        `json:"disconnects_sse"`
+	DisconnectsGRPC        int64        `json:"disconnects_grpc"`
+	PayloadsReceived       int64        `json:"payloads_received"`
+	PayloadsDelivered      int64        `json:"payloads_delivered"`
+	PayloadsDropped        int64        `json:"payloads_dropped"`
+	PublishToIngest        LatencyStats `json:"publish_to_ingest"`
+	IngestToEnqueue        LatencyStats `json:"ingest_to_enqueue"`
+	EnqueueToWrite         LatencyStats `json:"enqueue_to_write"`
 }
 
 type safeTime struct {
@@ -77,16 +90,34 @@ var connections int64
 var connectionsSSE int64
 var connectionsGRPC int64
 
+// NOTE: the following counters are never decremented
+var connectsSSE int64
+var connectsGRPC int64
+var disconnectsSSE int64
+var disconnectsGRPC int64
+
+var payloadsReceived int64
+var payloadsDelivered int64
+var payloadsDropped int64
+
+var connectionsRejected int64
+var connectionsRateLimited int64
+
+// NOTE: unix time of NotAfter of the current TLS certificate, 0 means TLS is disabled
+var tlsCertExpiry int64
+
 func IncConnection() {
 	atomic.AddInt64(&connections, 1)
 }
 
 func IncConnectionSSE() {
 	atomic.AddInt64(&connectionsSSE, 1)
+	atomic.AddInt64(&connectsSSE, 1)
 }
 
 func IncConnectionGRPC() {
 	atomic.AddInt64(&connectionsGRPC, 1)
+	atomic.AddInt64(&connectsGRPC, 1)
 }
 
 func DecConnection() {
@@ -95,10 +126,12 @@ func DecConnection() {
 
 func DecConnectionSSE() {
 	atomic.AddInt64(&connectionsSSE, -1)
+	atomic.AddInt64(&disconnectsSSE, 1)
 }
 
 func DecConnectionGRPC() {
 	atomic.AddInt64(&connectionsGRPC, -1)
+	atomic.AddInt64(&disconnectsGRPC, 1)
 }
 
 func GetConnection() int64 {
@@ -113,6 +146,82 @@ func GetConnectionGRPC() int64 {
 	return atomic.LoadInt64(&connectionsGRPC)
 }
 
+func GetConnectsSSE() int64 {
+	return atomic.LoadInt64(&connectsSSE)
+}
+
+func GetConnectsGRPC() int64 {
+	return atomic.LoadInt64(&connectsGRPC)
+}
+
+func GetDisconnectsSSE() int64 {
+	return atomic.LoadInt64(&disconnectsSSE)
+}
+
+func GetDisconnectsGRPC() int64 {
+	return atomic.LoadInt64(&disconnectsGRPC)
+}
+
+// IncPayloadReceived counts payloads received from the subscriber.
+func IncPayloadReceived() {
+	atomic.AddInt64(&payloadsReceived, 1)
+}
+
+// IncPayloadDelivered counts payloads written to clients.
+func IncPayloadDelivered() {
+	atomic.AddInt64(&payloadsDelivered, 1)
+}
+
+// IncPayloadDropped counts payloads which couldn't be written to clients.
+func IncPayloadDropped() {
+	atomic.AddInt64(&payloadsDropped, 1)
+}
+
+func GetPayloadReceived() int64 {
+	return atomic.LoadInt64(&payloadsReceived)
+}
+
+func GetPayloadDelivered() int64 {
+	return atomic.LoadInt64(&payloadsDelivered)
+}
+
+func GetPayloadDropped() int64 {
+	return atomic.LoadInt64(&payloadsDropped)
+}
+
+func IncConnectionRejected() {
+	atomic.AddInt64(&connectionsRejected, 1)
+}
+
+func IncRateLimited() {
+	atomic.AddInt64(&connectionsRateLimited, 1)
+}
+
+func GetConnectionRejected() int64 {
+	return atomic.LoadInt64(&connectionsRejected)
+}
+
+func GetRateLimited() int64 {
+	return atomic.LoadInt64(&connectionsRateLimited)
+}
+
+func SetTLSCertExpiry(notAfter time.Time) {
+	atomic.StoreInt64(&tlsCertExpiry, notAfter.Unix())
+}
+
+// GetTLSCertExpiry returns unix time when the current TLS certificate expires. 0 means TLS is disabled.
+func GetTLSCertExpiry() int64 {
+	return atomic.LoadInt64(&tlsCertExpiry)
+}
+
+func GetTLSCertDaysUntilExpiry() int64 {
+	expiry := atomic.LoadInt64(&tlsCertExpiry)
+	if expiry == 0 {
+		return 0
+	}
+	return int64(time.Until(time.Unix(expiry, 0)) / (24 * time.Hour))
+}
+
 func GetGoStats() *GoStats {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
@@ -193,9 +302,22 @@ func GetPlasmaStats() *PlasmaStats {
 	now := time.Now()
 
 	return &PlasmaStats{
-		Time:            now.UnixNano(),
-		Connections:     GetConnection(),
-		ConnectionsSSE:  GetConnectionSSE(),
-		ConnectionsGRPC: GetConnectionGRPC(),
+		Time:                   now.UnixNano(),
+		Connections:            GetConnection(),
+		ConnectionsSSE:         GetConnectionSSE(),
+		ConnectionsGRPC:        GetConnectionGRPC(),
+		TLSCertDaysUntilExpiry: GetTLSCertDaysUntilExpiry(),
+		ConnectionsRejected:    GetConnectionRejected(),
+		ConnectionsRateLimited: GetRateLimited(),
+		ConnectsSSE:            GetConnectsSSE(),
+		ConnectsGRPC:           GetConnectsGRPC(),
+		DisconnectsSSE:         GetDisconnectsSSE(),
+		DisconnectsGRPC:        GetDisconnectsGRPC(),
+		PayloadsReceived:       GetPayloadReceived(),
+		PayloadsDelivered:      GetPayloadDelivered(),
+		PayloadsDropped:        GetPayloadDropped(),
+		PublishToIngest:        getLatencyStats(publishToIngest),
+		IngestToEnqueue:        getLatencyStats(ingestToEnqueue),
+		EnqueueToWrite:         getLatencyStats(enqueueToWrite),
 	}
 }
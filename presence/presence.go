@@ -0,0 +1,235 @@
+package presence
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/pubsub"
+)
+
+// EventPrefix is the prefix of the event types of presence payloads.
+// ex) presence:program:1234 for the subscribers of program:1234
+const EventPrefix = "presence"
+
+const eventSeparator = ":"
+
+// Data is the data of a presence payload. Joined and Left are the changes since the last payload.
+type Data struct {
+	EventType string `json:"eventType"`
+	Count     int64  `json:"count"`
+	Joined    int64  `json:"joined"`
+	Left      int64  `json:"left"`
+}
+
+// Tracker counts the subscribers of the event types, and publishes the counts every interval if they are changed.
+// Joins and leaves in an interval are published as one payload.
+type Tracker struct {
+	eventTypes  []string
+	validator   *event.Validator
+	interval    time.Duration
+	pubsub      pubsub.PubSuber
+	errorLogger *zap.Logger
+
+	mu     sync.Mutex
+	local  map[string]int64
+	joined map[string]int64
+	left   map[string]int64
+	// NOTE: remote returns the counts of the other nodes, nil without the cluster
+	remote     func() (map[string]int64, error)
+	lastRemote map[string]int64
+	published  map[string]int64
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// New creates a tracker. The validator can be nil not to validate the presence event types.
+func New(config config.Presence, validator *event.Validator, pb pubsub.PubSuber, errorLogger *zap.Logger) *Tracker {
+	return &Tracker{
+		eventTypes:  config.EventTypes,
+		validator:   validator,
+		interval:    config.Interval,
+		pubsub:      pb,
+		errorLogger: errorLogger,
+		local:       make(map[string]int64),
+		joined:      make(map[string]int64),
+		left:        make(map[string]int64),
+		published:   make(map[string]int64),
+	}
+}
+
+// Tracks reports whether the subscribers of the event type are counted.
+func (t *Tracker) Tracks(eventType string) bool {
+	for _, e := range t.eventTypes {
+		if eventType == e || strings.HasPrefix(eventType, e+eventSeparator) {
+			// NOTE: clients can't subscribe to the presence event type if it's invalid, ex) it's too long
+			return t.validator == nil || t.validator.Validate([]string{EventPrefix + eventSeparator + eventType}) == nil
+		}
+	}
+	return false
+}
+
+// Join counts a subscriber of the event type. It doesn't block, so it can be called in the fan-out loop.
+func (t *Tracker) Join(eventType string) {
+	if !t.Tracks(eventType) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.local[eventType]++
+	t.joined[eventType]++
+}
+
+func (t *Tracker) Leave(eventType string) {
+	if !t.Tracks(eventType) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.local[eventType]--
+	t.left[eventType]++
+	if t.local[eventType] <= 0 {
+		delete(t.local, eventType)
+	}
+}
+
+// Counts returns the subscribers of this node, which are shared with the other nodes.
+func (t *Tracker) Counts() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int64, len(t.local))
+	for e, n := range t.local {
+		counts[e] = n
+	}
+	return counts
+}
+
+// SetRemote aggregates the counts of the other nodes into the payloads.
+func (t *Tracker) SetRemote(remote func() (map[string]int64, error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remote = remote
+}
+
+// Start publishes the changes every interval until Stop is called.
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done != nil {
+		return
+	}
+	t.done = make(chan struct{})
+	t.stopped = make(chan struct{})
+	go t.run(t.done, t.stopped)
+}
+
+func (t *Tracker) run(done, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	done, stopped := t.done, t.stopped
+	t.done = nil
+	t.mu.Unlock()
+	if done == nil {
+		return
+	}
+	close(done)
+	<-stopped
+}
+
+// changes returns the payload data of the event types whose counts are changed since the last flush.
+func (t *Tracker) changes(remote map[string]int64) []Data {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	eventTypes := make(map[string]struct{})
+	for _, m := range []map[string]int64{t.local, t.joined, t.left, t.published, remote} {
+		for e := range m {
+			eventTypes[e] = struct{}{}
+		}
+	}
+
+	var changes []Data
+	for e := range eventTypes {
+		count := t.local[e] + remote[e]
+		prev := t.published[e]
+		if count == prev && t.joined[e] == 0 && t.left[e] == 0 {
+			continue
+		}
+		d := Data{
+			EventType: e,
+			Count:     count,
+			Joined:    t.joined[e],
+			Left:      t.left[e],
+		}
+		// NOTE: only the net change is known for the other nodes
+		if diff := (count - prev) - (d.Joined - d.Left); diff > 0 {
+			d.Joined += diff
+		} else {
+			d.Left -= diff
+		}
+		changes = append(changes, d)
+		if count == 0 {
+			delete(t.published, e)
+		} else {
+			t.published[e] = count
+		}
+	}
+	t.joined = make(map[string]int64)
+	t.left = make(map[string]int64)
+	return changes
+}
+
+func (t *Tracker) flush() {
+	t.mu.Lock()
+	remoteFunc := t.remote
+	t.mu.Unlock()
+
+	remote := t.lastRemote
+	if remoteFunc != nil {
+		if r, err := remoteFunc(); err != nil {
+			// NOTE: publish the local changes with the last remote counts, not to report the other nodes as left
+			t.errorLogger.Error("failed to get presence of the other nodes",
+				zap.Error(err),
+			)
+		} else {
+			remote = r
+			t.lastRemote = r
+		}
+	}
+
+	for _, d := range t.changes(remote) {
+		b, err := json.Marshal(d)
+		if err != nil {
+			t.errorLogger.Error("failed to marshal presence",
+				zap.Error(err),
+				zap.String("event-type", d.EventType),
+			)
+			continue
+		}
+		t.pubsub.Publish(event.Payload{
+			Meta: event.MetaData{
+				Type: EventPrefix + eventSeparator + d.EventType,
+			},
+			Data: b,
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturePubSub struct {
+	mu       sync.Mutex
+	payloads []event.Payload
+}
+
+func (p *capturePubSub) Publish(payload event.Payload) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.payloads = append(p.payloads, payload)
+}
+
+func (p *capturePubSub) Subscribe(f func(payload event.Payload)) error {
+	return nil
+}
+
+// take returns the data of the published payloads by the event type, and clears them.
+func (p *capturePubSub) take(t *testing.T) map[string]Data {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	published := make(map[string]Data)
+	for _, payload := range p.payloads {
+		var d Data
+		require.NoError(t, json.Unmarshal(payload.Data, &d))
+		published[payload.Meta.Type] = d
+	}
+	p.payloads = nil
+	return published
+}
+
+func newTestTracker(t *testing.T, pb *capturePubSub) *Tracker {
+	l, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	require.NoError(t, err)
+	validator, err := event.NewValidator(config.Subscription{MaxDepth: 3})
+	require.NoError(t, err)
+	return New(config.Presence{
+		EventTypes: []string{"program"},
+		Interval:   time.Hour,
+	}, validator, pb, l)
+}
+
+func TestTracks(t *testing.T) {
+	tracker := newTestTracker(t, &capturePubSub{})
+
+	cases := []struct {
+		eventType string
+		expect    bool
+	}{
+		{eventType: "program", expect: true},
+		{eventType: "program:1234", expect: true},
+		// NOTE: presence:program:1234:views exceeds the max depth
+		{eventType: "program:1234:views", expect: false},
+		{eventType: "programs:1234", expect: false},
+		{eventType: "presence:program:1234", expect: false},
+		{eventType: "heartbeat", expect: false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, tracker.Tracks(c.eventType), c.eventType)
+	}
+}
+
+func TestTrackerFlush(t *testing.T) {
+	assert := assert.New(t)
+
+	pb := &capturePubSub{}
+	tracker := newTestTracker(t, pb)
+
+	// NOTE: joins and leaves in an interval are published at once
+	tracker.Join("program:1234")
+	tracker.Join("program:1234")
+	tracker.Join("program:1234")
+	tracker.Leave("program:1234")
+	tracker.Join("news:1")
+	tracker.flush()
+	assert.Equal(map[string]Data{
+		"presence:program:1234": {EventType: "program:1234", Count: 2, Joined: 3, Left: 1},
+	}, pb.take(t))
+	assert.Equal(map[string]int64{"program:1234": 2}, tracker.Counts())
+
+	tracker.flush()
+	assert.Empty(pb.take(t))
+
+	// NOTE: the changes of the other nodes are added as the net change
+	remote := map[string]int64{"program:1234": 5}
+	var remoteErr error
+	tracker.SetRemote(func() (map[string]int64, error) {
+		return remote, remoteErr
+	})
+	tracker.flush()
+	assert.Equal(map[string]Data{
+		"presence:program:1234": {EventType: "program:1234", Count: 7, Joined: 5},
+	}, pb.take(t))
+
+	// NOTE: the last remote counts are used if they can't be got
+	remoteErr = errors.New("redis is down")
+	remote = nil
+	tracker.Leave("program:1234")
+	tracker.flush()
+	assert.Equal(map[string]Data{
+		"presence:program:1234": {EventType: "program:1234", Count: 6, Left: 1},
+	}, pb.take(t))
+
+	remoteErr = nil
+	remote = map[string]int64{}
+	tracker.Leave("program:1234")
+	tracker.flush()
+	assert.Equal(map[string]Data{
+		"presence:program:1234": {EventType: "program:1234", Count: 0, Left: 6},
+	}, pb.take(t))
+	assert.Empty(tracker.Counts())
+
+	tracker.flush()
+	assert.Empty(pb.take(t))
+}
+
+func TestTrackerStart(t *testing.T) {
+	pb := &capturePubSub{}
+	tracker := newTestTracker(t, pb)
+	tracker.interval = 10 * time.Millisecond
+	tracker.Start()
+	defer tracker.Stop()
+
+	tracker.Join("program:1234")
+	var published map[string]Data
+	for i := 0; i < 100; i++ {
+		if published = pb.take(t); len(published) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int64(1), published["presence:program:1234"].Count)
+}
@@ -3,6 +3,7 @@ package pubsub
 import (
 	"github.com/mattn/go-pubsub"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/metrics"
 )
 
 type PubSuber interface {
@@ -21,6 +22,8 @@ func NewPubSub() PubSuber {
 }
 
 func (d *PubSub) Publish(payload event.Payload) {
+	metrics.IncPayloadReceived()
+	metrics.IncEventPublished(payload.Meta.Type)
 	d.pubsub.Pub(payload)
 }
 
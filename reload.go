@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/limit"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/openfresh/plasma/subscriber"
+)
+
+// applier applies the settings under the keys to a running component.
+// ex) the key "cors" matches "cors.allowedOrigins"
+type applier struct {
+	keys  []string
+	apply func(config.Config) error
+}
+
+func (a applier) matches(key string) bool {
+	for _, k := range a.keys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// reloader re-reads the config on SIGHUP and applies the settings which can be changed live.
+// The other settings are only reported because they require a restart.
+type reloader struct {
+	path     string
+	initial  config.Config
+	current  config.Config
+	appliers []applier
+	logger   *zap.Logger
+}
+
+// reloadables are the running components which can apply the config live.
+type reloadables struct {
+	accessLevel zap.AtomicLevel
+	errorLevel  zap.AtomicLevel
+	cors        interface {
+		Reload(config.Config)
+	}
+	sse interface {
+		Reload(config.ServerSentEvent)
+	}
+	limiter    *limit.Limiter
+	subscriber subscriber.Subscriber
+	metrics    *metricsRunner
+}
+
+func (r reloadables) appliers() []applier {
+	return []applier{
+		{keys: []string{"accessLog.level"}, apply: func(c config.Config) error {
+			return log.SetLevel(r.accessLevel, c.AccessLog.Level)
+		}},
+		{keys: []string{"errorLog.level"}, apply: func(c config.Config) error {
+			return log.SetLevel(r.errorLevel, c.ErrorLog.Level)
+		}},
+		{keys: []string{"cors", "origin"}, apply: func(c config.Config) error {
+			r.cors.Reload(c)
+			return nil
+		}},
+		{keys: []string{"sse.retry", "sse.heartbeatInterval"}, apply: func(c config.Config) error {
+			r.sse.Reload(c.SSE)
+			return nil
+		}},
+		{keys: []string{"trustedProxies"}, apply: func(c config.Config) error {
+			return log.SetTrustedProxies(c.TrustedProxies)
+		}},
+		{keys: []string{"limit"}, apply: func(c config.Config) error {
+			r.limiter.SetConfig(c.Limit)
+			return nil
+		}},
+		{keys: []string{"subscriber.redis.channels"}, apply: r.subscriber.Reload},
+		{keys: []string{"metrics.eventType"}, apply: func(c config.Config) error {
+			metrics.SetEventTypeConfig(c.Metrics.EventType)
+			return nil
+		}},
+		{keys: []string{"metrics.type", "metrics.interval", "metrics.log", "metrics.syslog", "metrics.statsd"}, apply: r.metrics.apply},
+	}
+}
+
+// metricsRunner starts the metrics when the type is set, and replaces the sender when the config is changed.
+type metricsRunner struct {
+	metrics *metrics.Metrics
+}
+
+func (r *metricsRunner) apply(c config.Config) error {
+	if r.metrics != nil {
+		return r.metrics.Reload(c.Metrics)
+	}
+	if c.Metrics.Type == "" {
+		return nil
+	}
+	m, err := metrics.NewMetrics(c)
+	// NOTE: the gauges are registered even if the sender fails, so keep it to retry by Reload
+	r.metrics = m
+	if err != nil {
+		return err
+	}
+	m.Start()
+	return nil
+}
+
+func (r *metricsRunner) stop() {
+	if r.metrics != nil {
+		r.metrics.Stop()
+	}
+}
+
+func newReloader(path string, c config.Config, logger *zap.Logger, r reloadables) *reloader {
+	return &reloader{
+		path:     path,
+		initial:  c,
+		current:  c,
+		appliers: r.appliers(),
+		logger:   logger,
+	}
+}
+
+func (r *reloader) reloadable(key string) bool {
+	for _, a := range r.appliers {
+		if a.matches(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reloader) reload() {
+	next, err := config.Load(r.path)
+	if err != nil {
+		r.logger.Error("failed to reload config, keep the current config",
+			zap.Error(err),
+			zap.String("path", r.path),
+		)
+		return
+	}
+
+	// NOTE: compare with the initial config to keep reporting until restart
+	var restart []string
+	for _, key := range config.Diff(r.initial, next) {
+		if !r.reloadable(key) {
+			restart = append(restart, key)
+		}
+	}
+
+	changed := config.Diff(r.current, next)
+	var applied []string
+	failed := false
+	for _, a := range r.appliers {
+		var keys []string
+		for _, key := range changed {
+			if a.matches(key) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if err := a.apply(next); err != nil {
+			r.logger.Error("failed to apply config",
+				zap.Error(err),
+				zap.Strings("keys", keys),
+			)
+			failed = true
+			continue
+		}
+		applied = append(applied, keys...)
+	}
+	// NOTE: the failed settings are applied again on the next reload
+	if !failed {
+		r.current = next
+	}
+
+	r.logger.Info("reloaded config",
+		zap.Strings("applied", applied),
+		zap.Strings("requireRestart", restart),
+	)
+	if len(restart) != 0 {
+		r.logger.Warn("some settings require a restart to take effect",
+			zap.Strings("keys", restart),
+		)
+	}
+}
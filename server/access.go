@@ -0,0 +1,91 @@
+package server
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/context"
+)
+
+// Reasons why connections are closed, which are logged in the access log.
+const (
+	closedByClient   = "client"
+	closedByServer   = "disconnected"
+	closedByDraining = "draining"
+	closedByError    = "error"
+)
+
+// connSummary counts what is sent to a connection, and is logged in the access log when the connection is closed.
+type connSummary struct {
+	mu       sync.Mutex
+	clientID string
+	events   []string
+	messages int64
+	bytes    int64
+	drops    int64
+	reason   string
+}
+
+func (s *connSummary) connect(clientID string, events []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientID = clientID
+	s.events = events
+}
+
+func (s *connSummary) setEvents(events []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = events
+}
+
+func (s *connSummary) sent(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages++
+	s.bytes += int64(bytes)
+}
+
+func (s *connSummary) dropped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops++
+}
+
+func (s *connSummary) close(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reason = reason
+}
+
+// fields returns nothing if the connection is rejected before streaming.
+func (s *connSummary) fields() []zapcore.Field {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientID == "" {
+		return nil
+	}
+	return []zapcore.Field{
+		zap.String("client-id", s.clientID),
+		zap.Strings("events", s.events),
+		zap.Int64("messages", s.messages),
+		zap.Int64("bytes", s.bytes),
+		zap.Int64("drops", s.drops),
+		zap.String("close-reason", s.reason),
+	}
+}
+
+type connSummaryKey struct{}
+
+func newConnSummaryContext(ctx context.Context, s *connSummary) context.Context {
+	return context.WithValue(ctx, connSummaryKey{}, s)
+}
+
+// connSummaryFromContext returns a new summary if the context has none, so that the caller doesn't need to check it.
+func connSummaryFromContext(ctx context.Context) *connSummary {
+	if s, ok := ctx.Value(connSummaryKey{}).(*connSummary); ok {
+		return s
+	}
+	return &connSummary{}
+}
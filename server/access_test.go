@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/manager"
+	"github.com/openfresh/plasma/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// waitAccessLog waits for the entry of the message to be written to the log file.
+func waitAccessLog(t *testing.T, path, msg string) map[string]interface{} {
+	for i := 0; i < 100; i++ {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		for _, line := range strings.Split(string(b), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			if entry["msg"] == msg {
+				return entry
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.FailNow(t, "no access log", msg)
+	return nil
+}
+
+func TestSSEAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		disconnect func(handler sseHandler, resp *http.Response)
+		reason     string
+	}{
+		{
+			disconnect: func(handler sseHandler, resp *http.Response) {
+				resp.Body.Close()
+			},
+			reason: closedByClient,
+		},
+		{
+			disconnect: func(handler sseHandler, resp *http.Response) {
+				handler.ClientManager().DisconnectAll(manager.Filter{})
+			},
+			reason: closedByServer,
+		},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "plasma-access-log")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "access.log")
+		accessLogger, err := log.NewLogger(config.Log{
+			Out:   path,
+			Level: "info",
+		})
+		require.NoError(t, err)
+		defer log.Close(accessLogger)
+
+		pb := pubsub.NewPubSub()
+		handler := setUpSSEHandler(t, pb, "")
+		handler.accessLogger = accessLogger
+		server := httptest.NewServer(handler)
+
+		resp, err := http.Get(server.URL + "/?eventType=program:1234")
+		require.NoError(t, err)
+		connect := waitAccessLog(t, path, "sse connect")
+		assert.Equal([]interface{}{"program:1234"}, connect["events"])
+
+		for i := 0; i < 2; i++ {
+			pb.Publish(event.Payload{
+				Meta: event.MetaData{Type: "program:1234:views"},
+				Data: json.RawMessage(`{"views": 1}`),
+			})
+		}
+		reader := bufio.NewReader(resp.Body)
+		for received := 0; received < 2; {
+			l, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if strings.HasPrefix(l, "data: ") {
+				received++
+			}
+		}
+
+		c.disconnect(handler, resp)
+		entry := waitAccessLog(t, path, "sse")
+		resp.Body.Close()
+		server.Close()
+
+		assert.Equal(connect["client-id"], entry["client-id"])
+		assert.Equal([]interface{}{"program:1234"}, entry["events"])
+		assert.Equal(float64(2), entry["messages"])
+		assert.True(entry["bytes"].(float64) > 0)
+		assert.Equal(float64(0), entry["drops"])
+		assert.Equal(c.reason, entry["close-reason"])
+		assert.Equal(float64(http.StatusOK), entry["status"])
+		assert.Contains(entry, "duration")
+	}
+}
+
+func TestConnSummary(t *testing.T) {
+	assert := assert.New(t)
+
+	// NOTE: nothing is logged for connections rejected before streaming
+	s := connSummaryFromContext(context.Background())
+	assert.Empty(s.fields())
+
+	ctx := newConnSummaryContext(context.Background(), s)
+	assert.True(s == connSummaryFromContext(ctx))
+
+	s.connect("1", []string{})
+	s.setEvents([]string{"program:1234"})
+	s.sent(10)
+	s.sent(20)
+	s.dropped()
+	s.close(closedByDraining)
+
+	assert.Equal(6, len(s.fields()))
+	assert.Equal(int64(2), s.messages)
+	assert.Equal(int64(30), s.bytes)
+	assert.Equal(int64(1), s.drops)
+	assert.Equal(closedByDraining, s.reason)
+}
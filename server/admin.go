@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/auth"
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/manager"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/pkg/errors"
+)
+
+const connectionsPath = "/admin/connections"
+
+type adminHandler struct {
+	token          []byte
+	clientManagers []*manager.ClientManager
+	cluster        ClusterStatser
+	accessLogger   *zap.Logger
+	errorLogger    *zap.Logger
+	config         config.Config
+	mux            *http.ServeMux
+}
+
+// NewAdminHandler creates the admin API to inspect and disconnect the connections of the client managers.
+func NewAdminHandler(opt Option, clientManagers ...*manager.ClientManager) (adminHandler, error) {
+	if opt.Config.Admin.TokenFile == "" {
+		return adminHandler{}, errors.New("admin token file is required")
+	}
+	b, err := ioutil.ReadFile(opt.Config.Admin.TokenFile)
+	if err != nil {
+		return adminHandler{}, errors.Wrapf(err, "failed to read admin token file: %s", opt.Config.Admin.TokenFile)
+	}
+	token := bytes.TrimRight(b, "\r\n")
+	if len(token) == 0 {
+		return adminHandler{}, errors.New("admin token is empty")
+	}
+
+	h := adminHandler{
+		token:          token,
+		clientManagers: clientManagers,
+		cluster:        opt.Cluster,
+		accessLogger:   opt.AccessLogger,
+		errorLogger:    opt.ErrorLogger,
+		config:         opt.Config,
+		mux:            http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc(connectionsPath, h.connections)
+	h.mux.HandleFunc(connectionsPath+"/", h.connection)
+	h.mux.HandleFunc("/admin/subscribers", h.subscribers)
+	h.mux.HandleFunc("/admin/nodes", h.nodes)
+	return h, nil
+}
+
+func (h adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if h.authenticate(r) {
+		h.mux.ServeHTTP(rec, r)
+	} else {
+		rec.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(rec, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+
+	fields := append(log.HTTPRequestToLogFields(r), zap.Int("status", rec.status))
+	h.accessLogger.Info("admin", fields...)
+}
+
+func (h adminHandler) authenticate(r *http.Request) bool {
+	// NOTE: the admin token is accepted only in the Authorization header
+	token, err := auth.TokenFromHeader(r)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), h.token) == 1
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func filterFromRequest(r *http.Request) manager.Filter {
+	q := r.URL.Query()
+	return manager.Filter{
+		Transport:  q.Get("transport"),
+		RemoteAddr: q.Get("remoteAddr"),
+		Subject:    q.Get("subject"),
+		Event:      q.Get("eventType"),
+	}
+}
+
+type connectionsResponse struct {
+	Count       int                  `json:"count"`
+	Connections []manager.Connection `json:"connections"`
+}
+
+type nodesResponse struct {
+	Count int                 `json:"count"`
+	Nodes []metrics.NodeStats `json:"nodes"`
+}
+
+type disconnectResponse struct {
+	Disconnected int `json:"disconnected"`
+}
+
+func (h adminHandler) writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.errorLogger.Error("failed to marshal admin response",
+			zap.Error(err),
+		)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// connections lists the connections, or disconnects the connections matching the filter.
+func (h adminHandler) connections(w http.ResponseWriter, r *http.Request) {
+	filter := filterFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		connections := make([]manager.Connection, 0)
+		for _, cm := range h.clientManagers {
+			connections = append(connections, cm.Connections(filter)...)
+		}
+		h.writeJSON(w, connectionsResponse{
+			Count:       len(connections),
+			Connections: connections,
+		})
+	case http.MethodDelete:
+		// NOTE: disconnecting all connections must be explicit
+		if filter.IsEmpty() && r.URL.Query().Get("all") != "true" {
+			http.Error(w, "specify a filter or all=true", http.StatusBadRequest)
+			return
+		}
+		n := 0
+		for _, cm := range h.clientManagers {
+			n += cm.DisconnectAll(filter)
+		}
+		h.errorLogger.Info("disconnected connections by the admin API",
+			zap.Int("connections", n),
+			zap.String("query", r.URL.RawQuery),
+		)
+		h.writeJSON(w, disconnectResponse{Disconnected: n})
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// connection disconnects the connection of the ID.
+func (h adminHandler) connection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, connectionsPath+"/")
+	for _, cm := range h.clientManagers {
+		if cm.Disconnect(id) {
+			h.errorLogger.Info("disconnected a connection by the admin API",
+				zap.String("id", id),
+			)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "connection not found", http.StatusNotFound)
+}
+
+// subscribers lists the connections receiving payloads of the event type.
+func (h adminHandler) subscribers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventType := r.URL.Query().Get("eventType")
+	if eventType == "" {
+		http.Error(w, "specify eventType", http.StatusBadRequest)
+		return
+	}
+
+	connections := make([]manager.Connection, 0)
+	for _, cm := range h.clientManagers {
+		connections = append(connections, cm.Subscribers(eventType)...)
+	}
+	h.writeJSON(w, connectionsResponse{
+		Count:       len(connections),
+		Connections: connections,
+	})
+}
+
+// nodes lists the live nodes of the cluster.
+func (h adminHandler) nodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.cluster == nil {
+		http.Error(w, "cluster is disabled", http.StatusNotFound)
+		return
+	}
+
+	s, err := h.cluster.Stats()
+	if err != nil {
+		h.errorLogger.Error("failed to get cluster stats",
+			zap.Error(err),
+		)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	h.writeJSON(w, nodesResponse{
+		Count: len(s.Nodes),
+		Nodes: s.Nodes,
+	})
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/openfresh/plasma/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "admin-token"
+
+func setUpAdminHandler(t *testing.T, sse sseHandler, cluster ClusterStatser) adminHandler {
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "plasma-admin-token")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(testAdminToken + "\n")
+	require.NoError(t, err)
+	f.Close()
+
+	handler, err := NewAdminHandler(Option{
+		AccessLogger: logger,
+		ErrorLogger:  logger,
+		Config: config.Config{
+			Admin: config.Admin{
+				TokenFile: f.Name(),
+			},
+		},
+		Cluster: cluster,
+	}, sse.ClientManager())
+	require.NoError(t, err)
+	return handler
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method, url string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func adminConnections(t *testing.T, handler http.Handler, url string) connectionsResponse {
+	rec := adminRequest(t, handler, http.MethodGet, url)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res connectionsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return res
+}
+
+func TestAdminHandlerUnauthorized(t *testing.T) {
+	handler := setUpAdminHandler(t, setUpSSEHandler(t, pubsub.NewPubSub(), ""), nil)
+
+	cases := []struct {
+		url   string
+		token string
+	}{
+		{url: "/admin/connections"},
+		{url: "/admin/connections", token: "Bearer invalid"},
+		// NOTE: the token in the query is rejected not to be leaked into the access log
+		{url: "/admin/connections?=" + testAdminToken},
+		{url: "/admin/connections?token=" + testAdminToken},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, c.url, nil)
+		require.NoError(t, err)
+		if c.token != "" {
+			req.Header.Set("Authorization", c.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, c.url)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	sse := setUpSSEHandler(t, pubsub.NewPubSub(), "")
+	server := httptest.NewServer(sse)
+	defer server.Close()
+	handler := setUpAdminHandler(t, sse, nil)
+
+	req, err := http.NewRequest("GET", server.URL+"/?eventType=program:1234:views", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "plasma-test")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var res connectionsResponse
+	for i := 0; i < 100; i++ {
+		if res = adminConnections(t, handler, "/admin/connections"); res.Count != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 1, res.Count)
+	conn := res.Connections[0]
+	assert.Equal("sse", conn.Transport)
+	assert.Equal("plasma-test", conn.UserAgent)
+	assert.Equal([]string{"program:1234:views"}, conn.Events)
+	assert.NotEmpty(conn.RemoteAddr)
+
+	assert.Equal(0, adminConnections(t, handler, "/admin/connections?transport=grpc").Count)
+	assert.Equal(1, adminConnections(t, handler, "/admin/subscribers?eventType=program:1234:views:detail").Count)
+	assert.Equal(0, adminConnections(t, handler, "/admin/subscribers?eventType=program:1234").Count)
+
+	assert.Equal(http.StatusBadRequest, adminRequest(t, handler, http.MethodDelete, "/admin/connections").Code)
+	assert.Equal(http.StatusNotFound, adminRequest(t, handler, http.MethodDelete, "/admin/connections/unknown").Code)
+	assert.Equal(http.StatusNoContent, adminRequest(t, handler, http.MethodDelete, "/admin/connections/"+conn.ID).Code)
+
+	// NOTE: the stream ends when the connection is disconnected
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+
+	for i := 0; i < 100; i++ {
+		if res = adminConnections(t, handler, "/admin/connections"); res.Count == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(0, res.Count)
+}
+
+func TestAdminHandlerNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	sse := setUpSSEHandler(t, pubsub.NewPubSub(), "")
+	handler := setUpAdminHandler(t, sse, nil)
+	assert.Equal(http.StatusNotFound, adminRequest(t, handler, http.MethodGet, "/admin/nodes").Code)
+
+	handler = setUpAdminHandler(t, sse, fakeCluster{stats: metrics.NewClusterStats([]metrics.NodeStats{
+		{ID: "node1", Connections: 2},
+		{ID: "node2", Connections: 3},
+	})})
+	rec := adminRequest(t, handler, http.MethodGet, "/admin/nodes")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res nodesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(2, res.Count)
+	assert.Equal("node2", res.Nodes[1].ID)
+	assert.Equal(int64(3), res.Nodes[1].Connections)
+
+	assert.Equal(http.StatusMethodNotAllowed, adminRequest(t, handler, http.MethodDelete, "/admin/nodes").Code)
+}
+
+func TestAdminHandlerCORS(t *testing.T) {
+	assert := assert.New(t)
+
+	admin := setUpAdminHandler(t, setUpSSEHandler(t, pubsub.NewPubSub(), ""), nil)
+	cors := NewCORSHandler(Option{
+		Config: config.Config{
+			CORS: config.CORS{
+				AllowedOrigins: []string{"https://admin.example.com"},
+				AllowedMethods: []string{http.MethodGet, http.MethodDelete},
+				AllowedHeaders: []string{"Authorization"},
+			},
+		},
+	}, http.NotFoundHandler())
+	handler := cors.Wrap(admin)
+
+	// NOTE: the preflight doesn't have the admin token
+	req, err := http.NewRequest(http.MethodOptions, "/admin/connections", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "https://admin.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusNoContent, rec.Code)
+	assert.Equal("https://admin.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal("Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	// NOTE: the wrapped handler shares the reloaded policy
+	cors.Reload(config.Config{
+		CORS: config.CORS{AllowedOrigins: []string{"https://evil.com"}},
+	})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	req, err = http.NewRequest(http.MethodGet, "/admin/connections", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "https://evil.com")
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("https://evil.com", rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,21 @@
+package server
+
+// encodedMessage is a message encoded in protocol buffers at fan-out time.
+// NOTE: it implements proto.Marshaler, so the default codec writes it as it is, only for the sent payloads
+type encodedMessage struct {
+	data []byte
+}
+
+func (m *encodedMessage) Reset() {
+	m.data = nil
+}
+
+func (m *encodedMessage) String() string {
+	return string(m.data)
+}
+
+func (*encodedMessage) ProtoMessage() {}
+
+func (m *encodedMessage) Marshal() ([]byte, error) {
+	return m.data, nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"testing"
+
+	protobuf "github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfresh/plasma/protobuf"
+)
+
+func TestEncodedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &proto.Payload{
+		EventType: eventType("program:1234:views"),
+		Data:      `{"views": 55301}`,
+	}
+	expect, err := protobuf.Marshal(p)
+	require.NoError(t, err)
+
+	// NOTE: the encoded message is written as it is
+	b, err := protobuf.Marshal(&encodedMessage{data: expect})
+	require.NoError(t, err)
+	assert.Equal(expect, b)
+
+	var actual proto.Payload
+	require.NoError(t, protobuf.Unmarshal(b, &actual))
+	assert.Equal(p.EventType.Type, actual.EventType.Type)
+	assert.Equal(p.Data, actual.Data)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openfresh/plasma/config"
+)
+
+// corsHandler applies the CORS policy to every endpoint of the wrapped handler.
+type corsHandler struct {
+	next http.Handler
+	// NOTE: *corsPolicy, which is replaced by Reload
+	policy *atomic.Value
+}
+
+type corsPolicy struct {
+	origins          []string
+	allowedMethods   string
+	allowedHeaders   string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+func newCORSPolicy(config config.Config) *corsPolicy {
+	c := config.CORS
+	origins := c.AllowedOrigins
+	if config.Origin != "" {
+		origins = append(origins[:len(origins):len(origins)], config.Origin)
+	}
+	return &corsPolicy{
+		origins:          origins,
+		allowedMethods:   strings.Join(c.AllowedMethods, ", "),
+		allowedHeaders:   strings.Join(c.AllowedHeaders, ", "),
+		exposedHeaders:   strings.Join(c.ExposedHeaders, ", "),
+		allowCredentials: c.AllowCredentials,
+		maxAge:           strconv.Itoa(int(c.MaxAge.Seconds())),
+	}
+}
+
+func NewCORSHandler(opt Option, next http.Handler) corsHandler {
+	h := corsHandler{
+		next:   next,
+		policy: &atomic.Value{},
+	}
+	h.Reload(opt.Config)
+	return h
+}
+
+// Wrap applies the same CORS policy to another handler. ex) the admin API on the metrics server
+func (h corsHandler) Wrap(next http.Handler) corsHandler {
+	return corsHandler{
+		next:   next,
+		policy: h.policy,
+	}
+}
+
+// Reload replaces the CORS policy. Requests in progress keep the previous one.
+func (h corsHandler) Reload(config config.Config) {
+	h.policy.Store(newCORSPolicy(config))
+}
+
+// matchOrigin reports whether the origin matches the pattern. The pattern can contain one wildcard.
+// ex) "https://*.example.com" matches "https://www.example.com"
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return len(origin) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+// allowOrigin returns the value of Access-Control-Allow-Origin for the origin.
+func (p *corsPolicy) allowOrigin(origin string) (string, bool) {
+	for _, o := range p.origins {
+		// NOTE: "*" with credentials is rejected by the config validation
+		if o == "*" {
+			return "*", true
+		}
+		if matchOrigin(o, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+func (h corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := h.policy.Load().(*corsPolicy)
+	if len(p.origins) == 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	allowed, ok := p.allowOrigin(origin)
+	if !ok {
+		if preflight {
+			http.Error(w, "origin not allowed: "+origin, http.StatusForbidden)
+			return
+		}
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", allowed)
+	if p.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", p.allowedMethods)
+		if p.allowedHeaders != "" {
+			w.Header().Set("Access-Control-Allow-Headers", p.allowedHeaders)
+		}
+		w.Header().Set("Access-Control-Max-Age", p.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if p.exposedHeaders != "" {
+		w.Header().Set("Access-Control-Expose-Headers", p.exposedHeaders)
+	}
+	h.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern string
+		origin  string
+		expect  bool
+	}{
+		{pattern: "https://example.com", origin: "https://example.com", expect: true},
+		{pattern: "https://example.com", origin: "https://EXAMPLE.com", expect: true},
+		{pattern: "https://example.com", origin: "http://example.com", expect: false},
+		{pattern: "https://*.example.com", origin: "https://www.example.com", expect: true},
+		{pattern: "https://*.example.com", origin: "https://example.com", expect: false},
+		{pattern: "https://*.example.com", origin: "https://www.example.com.evil.com", expect: false},
+		{pattern: "*.test.com", origin: "https://a.test.com", expect: true},
+		{pattern: "*", origin: "https://example.com", expect: true},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, matchOrigin(c.pattern, c.origin), "%s %s", c.pattern, c.origin)
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		cors          config.CORS
+		method        string
+		origin        string
+		requestMethod string
+		status        int
+		allowOrigin   string
+		credentials   string
+	}{
+		{
+			cors:        config.CORS{AllowedOrigins: []string{"https://a.example.com", "https://*.test.com"}},
+			method:      http.MethodGet,
+			origin:      "https://a.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://a.example.com",
+		},
+		{
+			cors:        config.CORS{AllowedOrigins: []string{"https://a.example.com", "https://*.test.com"}},
+			method:      http.MethodGet,
+			origin:      "https://b.test.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://b.test.com",
+		},
+		{
+			cors:   config.CORS{AllowedOrigins: []string{"https://a.example.com"}},
+			method: http.MethodGet,
+			origin: "https://evil.com",
+			status: http.StatusOK,
+		},
+		{
+			cors:        config.CORS{AllowedOrigins: []string{"*"}},
+			method:      http.MethodGet,
+			origin:      "https://a.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "*",
+		},
+		{
+			cors:        config.CORS{AllowedOrigins: []string{"https://a.example.com"}, AllowCredentials: true},
+			method:      http.MethodGet,
+			origin:      "https://a.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://a.example.com",
+			credentials: "true",
+		},
+		{
+			cors:          config.CORS{AllowedOrigins: []string{"https://a.example.com"}},
+			method:        http.MethodOptions,
+			origin:        "https://a.example.com",
+			requestMethod: http.MethodGet,
+			status:        http.StatusNoContent,
+			allowOrigin:   "https://a.example.com",
+		},
+		{
+			cors:          config.CORS{AllowedOrigins: []string{"https://a.example.com"}},
+			method:        http.MethodOptions,
+			origin:        "https://evil.com",
+			requestMethod: http.MethodGet,
+			status:        http.StatusForbidden,
+		},
+		{
+			cors:   config.CORS{},
+			method: http.MethodGet,
+			origin: "https://a.example.com",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		c.cors.AllowedMethods = []string{"GET", "POST"}
+		c.cors.AllowedHeaders = []string{"Authorization", "Last-Event-ID"}
+		c.cors.MaxAge = time.Minute
+		handler := NewCORSHandler(Option{Config: config.Config{CORS: c.cors}}, next)
+
+		req, err := http.NewRequest(c.method, "/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", c.origin)
+		if c.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", c.requestMethod)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(c.status, rec.Code)
+		assert.Equal(c.allowOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(c.credentials, rec.Header().Get("Access-Control-Allow-Credentials"))
+		if len(c.cors.AllowedOrigins) != 0 {
+			assert.Contains(rec.Header()["Vary"], "Origin")
+		}
+		if c.status == http.StatusNoContent {
+			assert.Equal("GET, POST", rec.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal("Authorization, Last-Event-ID", rec.Header().Get("Access-Control-Allow-Headers"))
+			assert.Equal("60", rec.Header().Get("Access-Control-Max-Age"))
+		}
+	}
+}
+
+func TestCORSHandlerReload(t *testing.T) {
+	assert := assert.New(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := NewCORSHandler(Option{Config: config.Config{
+		CORS: config.CORS{AllowedOrigins: []string{"https://a.example.com"}},
+	}}, next)
+
+	allowOrigin := func(origin string) string {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	assert.Equal("https://a.example.com", allowOrigin("https://a.example.com"))
+	assert.Equal("", allowOrigin("https://b.example.com"))
+
+	handler.Reload(config.Config{
+		CORS: config.CORS{AllowedOrigins: []string{"https://b.example.com"}},
+	})
+	assert.Equal("", allowOrigin("https://a.example.com"))
+	assert.Equal("https://b.example.com", allowOrigin("https://b.example.com"))
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/manager"
+)
+
+// Drainer closes connections in waves before shutdown, so that clients don't reconnect all at once.
+// The nil Drainer never drains.
+type Drainer struct {
+	draining    int32
+	config      config.Drain
+	errorLogger *zap.Logger
+	mu          sync.Mutex
+	rand        *rand.Rand
+}
+
+func NewDrainer(config config.Drain, errorLogger *zap.Logger) *Drainer {
+	return &Drainer{
+		config:      config,
+		errorLogger: errorLogger,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Draining reports whether new clients should be rejected.
+func (d *Drainer) Draining() bool {
+	return d != nil && atomic.LoadInt32(&d.draining) == 1
+}
+
+// RetryJitter returns a random duration to spread reconnections of SSE clients.
+func (d *Drainer) RetryJitter() time.Duration {
+	if d == nil || d.config.RetryJitter <= 0 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Duration(d.rand.Int63n(int64(d.config.RetryJitter)))
+}
+
+type drainTarget struct {
+	clientManager *manager.ClientManager
+	id            string
+}
+
+// Drain stops accepting new clients and closes the connected clients in waves.
+// The remaining clients are closed at once when the context is done.
+func (d *Drainer) Drain(ctx context.Context, clientManagers ...*manager.ClientManager) {
+	if !atomic.CompareAndSwapInt32(&d.draining, 0, 1) {
+		return
+	}
+
+	targets := make([]drainTarget, 0)
+	for _, cm := range clientManagers {
+		for _, c := range cm.Connections(manager.Filter{}) {
+			targets = append(targets, drainTarget{clientManager: cm, id: c.ID})
+		}
+	}
+
+	waves := d.config.Waves
+	if waves <= 0 {
+		waves = 1
+	}
+	size := (len(targets) + waves - 1) / waves
+
+	d.errorLogger.Info("draining connections",
+		zap.Int("connections", len(targets)),
+		zap.Int("waves", waves),
+	)
+
+	for len(targets) != 0 {
+		n := size
+		if n > len(targets) {
+			n = len(targets)
+		}
+		for _, t := range targets[:n] {
+			t.clientManager.Disconnect(t.id)
+		}
+		targets = targets[n:]
+		if len(targets) == 0 {
+			break
+		}
+
+		select {
+		case <-time.After(d.config.Interval):
+		case <-ctx.Done():
+			// NOTE: close the rest at once
+			size = len(targets)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/manager"
+	"github.com/openfresh/plasma/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func newTestDrainer(t *testing.T, c config.Drain) *Drainer {
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+	return NewDrainer(c, logger)
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		clients int
+		waves   int
+		timeout time.Duration
+	}{
+		{clients: 5, waves: 2, timeout: time.Minute},
+		{clients: 3, waves: 0, timeout: time.Minute},
+		{clients: 0, waves: 2, timeout: time.Minute},
+		// NOTE: the rest are closed at once after the timeout
+		{clients: 5, waves: 5, timeout: 0},
+	}
+
+	for _, c := range cases {
+		drainer := newTestDrainer(t, config.Drain{
+			Waves:    c.waves,
+			Interval: 10 * time.Millisecond,
+		})
+		cm := manager.NewClientManager()
+		clients := make([]manager.Client, c.clients)
+		for i := range clients {
+			clients[i] = manager.NewClient([]string{"program:1234"})
+			cm.AddClient(clients[i])
+		}
+
+		assert.False(drainer.Draining())
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		drainer.Drain(ctx, cm)
+		cancel()
+		assert.True(drainer.Draining())
+
+		for _, client := range clients {
+			select {
+			case <-client.Closed():
+			default:
+				assert.Fail("client should be closed", "%+v", c)
+			}
+		}
+	}
+
+	var nilDrainer *Drainer
+	assert.False(nilDrainer.Draining())
+	assert.Equal(time.Duration(0), nilDrainer.RetryJitter())
+}
+
+func TestSSEHandlerDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	drainer := newTestDrainer(t, config.Drain{
+		Waves:       1,
+		RetryJitter: time.Second,
+	})
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "")
+	handler.drainer = drainer
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?eventType=program:1234")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	for i := 0; i < 100 && len(handler.ClientManager().Connections(manager.Filter{})) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	drainer.Drain(context.Background(), handler.ClientManager())
+
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	matches := regexp.MustCompile(`retry: (\d+)\n\n$`).FindSubmatch(b)
+	require.Len(t, matches, 2, string(b))
+	retry, err := strconv.Atoi(string(matches[1]))
+	require.NoError(t, err)
+	assert.True(retry >= handler.retryMillis() && retry < handler.retryMillis()+1000, "retry: %d", retry)
+
+	// NOTE: new clients are rejected while draining
+	resp, err = http.Get(server.URL + "/?eventType=program:1234")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+
+	meta := NewMetaHandler(Option{
+		AccessLogger: handler.accessLogger,
+		ErrorLogger:  handler.errorLogger,
+		Drainer:      drainer,
+	})
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	meta.ServeHTTP(rec, req)
+	assert.Equal(http.StatusServiceUnavailable, rec.Code)
+}
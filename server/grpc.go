@@ -2,27 +2,36 @@ package server
 
 import (
 	"io"
+	"strings"
 	"time"
 
+	protobuf "github.com/golang/protobuf/proto"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
 	"github.com/openfresh/plasma/manager"
 	"github.com/openfresh/plasma/metrics"
 	"github.com/openfresh/plasma/protobuf"
 	"github.com/openfresh/plasma/pubsub"
+	"github.com/openfresh/plasma/trace"
 	"github.com/pkg/errors"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 type GRPCServer struct {
 	*grpc.Server
+	streamServer *StreamServer
 	accessLogger *zap.Logger
 	errorLogger  *zap.Logger
 	config       config.Config
@@ -30,14 +39,66 @@ type GRPCServer struct {
 
 func (s *GRPCServer) StreamAccessLogHandler(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	start := time.Now()
-	err := handler(srv, ss)
+	summary := &connSummary{}
+	err := handler(srv, contextServerStream{
+		ServerStream: ss,
+		ctx:          newConnSummaryContext(ss.Context(), summary),
+	})
 	fields := log.GRPCRequestToLogFields(info, start, err)
+	fields = append(fields, summary.fields()...)
 
 	s.accessLogger.Info("grpc", fields...)
 
 	return err
 }
 
+// contextServerStream carries values of the stream in the context, ex) the span, the summary for the access log
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// traceparentMetadata is the metadata key of the W3C trace context.
+const traceparentMetadata = "traceparent"
+
+func (s *GRPCServer) StreamTraceHandler(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var parent trace.SpanContext
+	if md, ok := metadata.FromIncomingContext(ss.Context()); ok && len(md[traceparentMetadata]) != 0 {
+		parent = trace.FromTraceparent(md[traceparentMetadata][0])
+	}
+
+	span := trace.Start(info.FullMethod, parent, trace.KindServer)
+	defer span.End()
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", info.FullMethod)
+
+	err := handler(srv, contextServerStream{
+		ServerStream: ss,
+		ctx:          trace.NewContext(ss.Context(), span),
+	})
+	span.SetAttribute("rpc.grpc.status_code", int(grpc.Code(err)))
+	span.SetError(err)
+	return err
+}
+
+// chainStreamInterceptors chains interceptors. The first one is the outermost.
+func chainStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, next)
+			}
+		}
+		return chained(srv, ss)
+	}
+}
+
 func NewGRPCServer(opt Option) (*GRPCServer, error) {
 	gs := &GRPCServer{
 		accessLogger: opt.AccessLogger,
@@ -47,16 +108,23 @@ func NewGRPCServer(opt Option) (*GRPCServer, error) {
 
 	opts := make([]grpc.ServerOption, 0)
 
-	tls := opt.Config.TLS
-	if tls.CertFile != "" && tls.KeyFile != "" {
-		creds, err := credentials.NewServerTLSFromFile(tls.CertFile, tls.KeyFile)
+	tlsConfig := opt.TLSConfig
+	if cert := opt.Config.TLS; tlsConfig == nil && cert.CertFile != "" && cert.KeyFile != "" {
+		var err error
+		tlsConfig, err = NewTLSConfig(cert, opt.ErrorLogger)
 		if err != nil {
 			return nil, err
 		}
-		opts = append(opts, grpc.Creds(creds))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
-	opts = append(opts, grpc.StreamInterceptor(gs.StreamAccessLogHandler))
+	// NOTE: grpc.StreamInterceptor can be specified only once
+	opts = append(opts, grpc.StreamInterceptor(chainStreamInterceptors(
+		gs.StreamTraceHandler,
+		gs.StreamAccessLogHandler,
+	)))
 	gs.Server = grpc.NewServer(opts...)
 
 	ss, err := NewStreamServer(opt)
@@ -64,37 +132,76 @@ func NewGRPCServer(opt Option) (*GRPCServer, error) {
 		return nil, errors.Wrap(err, "failed to NewStreamServer")
 	}
 	proto.RegisterStreamServiceServer(gs.Server, ss)
+	gs.streamServer = ss
 
 	return gs, nil
 }
 
-type refreshEvents struct {
-	client *manager.Client
+// ClientManager returns the clients connected via gRPC.
+func (s *GRPCServer) ClientManager() *manager.ClientManager {
+	return s.streamServer.clientManager
+}
+
+// Ping checks that the fan-out loop of gRPC streams is responsive.
+func (s *GRPCServer) Ping(timeout time.Duration) error {
+	return s.streamServer.Ping(timeout)
+}
+
+type clientUpdateType int
+
+const (
+	addClient clientUpdateType = iota
+	refreshClient
+	removeClient
+)
+
+// clientUpdate is sent to one channel to apply adding, refreshing and removing a client in the order of the stream.
+type clientUpdate struct {
+	updateType clientUpdateType
+	client     manager.Client
+	// events are the events of refreshClient
 	events []string
 }
 
 type StreamServer struct {
-	clientManager  *manager.ClientManager
-	newClients     chan manager.Client
-	removeClients  chan manager.Client
-	payloads       chan event.Payload
-	resfreshEvents chan refreshEvents
-	pubsub         pubsub.PubSuber
-	accessLogger   *zap.Logger
-	errorLogger    *zap.Logger
+	clientManager *manager.ClientManager
+	clientUpdates chan clientUpdate
+	payloads      chan event.Payload
+	pings         chan struct{}
+	pubsub        pubsub.PubSuber
+	authenticator auth.Authenticator
+	authorizer    auth.Authorizer
+	limiter       *limit.Limiter
+	drainer       *Drainer
+	validator     *event.Validator
+	accessLogger  *zap.Logger
+	errorLogger   *zap.Logger
+	config        config.Config
 }
 
 func NewStreamServer(opt Option) (*StreamServer, error) {
+	validator, err := event.NewValidator(opt.Config.Subscription)
+	if err != nil {
+		return nil, err
+	}
 	ss := &StreamServer{
-		clientManager:  manager.NewClientManager(),
-		newClients:     make(chan manager.Client, 20),
-		removeClients:  make(chan manager.Client, 20),
-		payloads:       make(chan event.Payload, 20),
-		resfreshEvents: make(chan refreshEvents, 20),
-		pubsub:         opt.PubSuber,
-		accessLogger:   opt.AccessLogger,
-		errorLogger:    opt.ErrorLogger,
+		clientUpdates: make(chan clientUpdate, 60),
+		payloads:      make(chan event.Payload, 20),
+		pings:         make(chan struct{}),
+		pubsub:        opt.PubSuber,
+		authenticator: opt.Authenticator,
+		authorizer:    opt.Authorizer,
+		limiter:       opt.Limiter,
+		drainer:       opt.Drainer,
+		validator:     validator,
+		accessLogger:  opt.AccessLogger,
+		errorLogger:   opt.ErrorLogger,
+		config:        opt.Config,
 	}
+	ss.clientManager = manager.NewClientManagerWithOption(manager.Option{
+		Observer: opt.Observer,
+		Encoder:  ss.encode,
+	})
 	if err := ss.pubsub.Subscribe(func(payload event.Payload) {
 		ss.payloads <- payload
 	}); err != nil {
@@ -105,57 +212,230 @@ func NewStreamServer(opt Option) (*StreamServer, error) {
 	return ss, nil
 }
 
+// Ping checks that the fan-out loop is responsive.
+func (ss *StreamServer) Ping(timeout time.Duration) error {
+	return ping(ss.pings, timeout)
+}
+
 func (ss *StreamServer) Run() {
 	go func() {
 		for {
 			select {
-			case client := <-ss.newClients:
-				ss.clientManager.AddClient(client)
-				metrics.IncConnection()
-				metrics.IncConnectionGRPC()
-			case client := <-ss.removeClients:
-				ss.clientManager.RemoveClient(client)
-				metrics.DecConnection()
-				metrics.DecConnectionGRPC()
+			case u := <-ss.clientUpdates:
+				ss.update(u)
 			case payload := <-ss.payloads:
 				ss.clientManager.SendPayload(payload)
-			case re := <-ss.resfreshEvents:
-				ss.clientManager.DeleteEvents(re.client)
-				re.client.SetEvents(re.events)
-				ss.clientManager.AddClient(*re.client)
+			case <-ss.pings:
 			}
 		}
 	}()
 }
 
+// encode serializes the payload in protocol buffers, which is shared by all streams.
+func (ss *StreamServer) encode(pl event.Payload) (*event.Encoded, error) {
+	eventType := proto.EventType{Type: pl.Meta.Type}
+	b, err := protobuf.Marshal(&proto.Payload{
+		EventType: &eventType,
+		Data:      string(pl.Data),
+	})
+	if err != nil {
+		ss.errorLogger.Error("failed to marshal event payload",
+			zap.Error(err),
+			zap.Object("payload", pl),
+		)
+		return nil, err
+	}
+	return &event.Encoded{Proto: b}, nil
+}
+
+func (ss *StreamServer) update(u clientUpdate) {
+	switch u.updateType {
+	case addClient:
+		ss.clientManager.AddClient(u.client)
+		metrics.IncConnection()
+		metrics.IncConnectionGRPC()
+	case refreshClient:
+		// NOTE: the events of the removed client are ignored
+		ss.clientManager.SetEvents(u.client.ID(), u.events)
+	case removeClient:
+		ss.clientManager.RemoveClient(u.client)
+		metrics.DecConnection()
+		metrics.DecConnectionGRPC()
+	}
+}
+
+func (ss *StreamServer) authenticate(ctx context.Context) (auth.Claims, error) {
+	var claims auth.Claims
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			claims = auth.FromTLS(&info.State)
+		}
+	}
+	if ss.authenticator == nil {
+		return claims, nil
+	}
+	token, err := auth.TokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ss.authenticator.Authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+	return auth.WithCertificate(c, claims)
+}
+
+// deniedEventsMetadata reports event types dropped by the authorizer.
+const deniedEventsMetadata = "x-plasma-denied-events"
+
+// deniedReport passes the denied event types from the receiving goroutine to the sending one.
+type deniedReport struct {
+	events []string
+	// reported is closed when the events are set in the header or trailer
+	reported chan struct{}
+}
+
+// reportDeniedEvents is called by the goroutine sending the payloads,
+// so that the header isn't set concurrently with SendMsg.
+func (ss *StreamServer) reportDeniedEvents(es proto.StreamService_EventsServer, r deniedReport, sent bool) {
+	defer close(r.reported)
+	md := metadata.Pairs(deniedEventsMetadata, strings.Join(r.events, ","))
+	// NOTE: header can't be set after sending the first payload
+	if sent || es.SetHeader(md) != nil {
+		es.SetTrailer(md)
+	}
+}
+
+// goawayMetadata notifies that the server is shutting down and the client should reconnect to another server.
+const goawayMetadata = "x-plasma-goaway"
+
 func (ss *StreamServer) Events(es proto.StreamService_EventsServer) error {
-	client := manager.NewClient([]string{})
-	ss.newClients <- client
+	if ss.drainer.Draining() {
+		return grpc.Errorf(codes.Unavailable, "server is shutting down")
+	}
+
+	if ss.limiter != nil {
+		addr := log.RemoteAddrFromContext(es.Context())
+		if err := ss.limiter.Acquire(limit.GRPC, addr); err != nil {
+			ss.errorLogger.Info("failed to acquire a connection",
+				zap.Error(err),
+				zap.String("remote-addr", addr),
+			)
+			return grpc.Errorf(codes.ResourceExhausted, "%s", err)
+		}
+		defer ss.limiter.Release(limit.GRPC, addr)
+	}
+
+	claims, err := ss.authenticate(es.Context())
+	if err != nil {
+		ss.errorLogger.Info("failed to authenticate",
+			zap.Error(err),
+		)
+		return grpc.Errorf(codes.Unauthenticated, "unauthenticated: %s", err)
+	}
+	trace.FromContext(es.Context()).SetAttribute("enduser.id", claims.Subject())
+
+	var userAgent string
+	if md, ok := metadata.FromIncomingContext(es.Context()); ok && len(md["user-agent"]) != 0 {
+		userAgent = md["user-agent"][0]
+	}
+	client := manager.NewClientWithInfo([]string{}, manager.ClientInfo{
+		Transport:  limit.GRPC,
+		RemoteAddr: log.RemoteAddrFromContext(es.Context()),
+		UserAgent:  userAgent,
+		Subject:    claims.Subject(),
+	})
+	ss.clientUpdates <- clientUpdate{updateType: addClient, client: client}
 	defer func() {
-		ss.removeClients <- client
+		// NOTE: close the client first not to block SendPayload until it is removed
+		client.Close()
+		ss.clientUpdates <- clientUpdate{updateType: removeClient, client: client}
 	}()
+	summary := connSummaryFromContext(es.Context())
+	summary.connect(client.ID(), []string{})
+	ss.accessLogger.Info("grpc connect",
+		zap.String("client-id", client.ID()),
+		zap.String("remote-addr", log.RemoteAddrFromContext(es.Context())),
+		zap.String("user-agent", userAgent),
+		zap.String("subject", claims.Subject()),
+		zap.String("time", time.Now().Format(time.RFC3339)),
+	)
 
+	deniedCh := make(chan deniedReport)
 	go func() {
-		for pl := range client.ReceivePayload() {
-			eventType := proto.EventType{Type: pl.Meta.Type}
-			p := &proto.Payload{
-				EventType: &eventType,
-				Data:      string(pl.Data),
+		sent := false
+		for {
+			var pl event.Payload
+			select {
+			case pl = <-client.ReceivePayload():
+			case r := <-deniedCh:
+				ss.reportDeniedEvents(es, r, sent)
+				continue
+			case <-client.Closed():
+				return
 			}
-			if err := es.Send(p); err != nil {
+			sent = true
+			span := trace.Start("plasma.grpc.send", trace.FromTraceparent(pl.Meta.Traceparent), trace.KindProducer)
+			span.SetAttribute("plasma.event_type", pl.Meta.Type)
+			encoded := pl.Encoded
+			var err error
+			if encoded == nil {
+				encoded, err = ss.encode(pl)
+			}
+			if err == nil {
+				err = es.SendMsg(&encodedMessage{data: encoded.Proto})
+			}
+			span.SetError(err)
+			span.End()
+			if err != nil {
 				ss.errorLogger.Error("failed to send message",
 					zap.Error(err),
 					zap.Object("payload", pl),
 				)
+				metrics.IncPayloadDropped()
+				summary.dropped()
 				// TODO error handling
 			} else {
 				ss.errorLogger.Debug("success to receive payload",
 					zap.Object("payload", pl),
 				)
+				size := len(encoded.Proto)
+				summary.sent(size)
+				metrics.IncPayloadDelivered()
+				metrics.AddEventDelivered(pl.Meta.Type, size)
+				if !pl.EnqueuedAt.IsZero() {
+					metrics.ObserveEnqueueToWrite(time.Since(pl.EnqueuedAt))
+				}
 			}
 		}
 	}()
 
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ss.receive(es, &client, claims, summary, deniedCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			summary.close(closedByError)
+		} else {
+			summary.close(closedByClient)
+		}
+		return err
+	case <-client.Closed():
+		if ss.drainer.Draining() {
+			summary.close(closedByDraining)
+			es.SetTrailer(metadata.Pairs(goawayMetadata, "draining"))
+			return grpc.Errorf(codes.Unavailable, "server is shutting down")
+		}
+		summary.close(closedByServer)
+		return grpc.Errorf(codes.Unavailable, "disconnected by the server")
+	}
+}
+
+// receive reports the denied event types by the sending goroutine before the client subscribes the others.
+func (ss *StreamServer) receive(es proto.StreamService_EventsServer, client *manager.Client, claims auth.Claims, summary *connSummary, deniedCh chan<- deniedReport) error {
 	for {
 		request, err := es.Recv()
 		if err == io.EOF {
@@ -173,13 +453,17 @@ func (ss *StreamServer) Events(es proto.StreamService_EventsServer) error {
 			return nil
 		}
 
-		ss.accessLogger.Info("gRPC",
+		// NOTE: the events are logged in the summary when the stream ends
+		ss.accessLogger.Debug("gRPC",
+			zap.String("client-id", client.ID()),
 			zap.Array("request-events", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
 				for _, e := range request.Events {
 					enc.AppendString(e.Type)
 				}
 				return nil
 			})),
+			zap.String("subject", claims.Subject()),
+			zap.String("cert-subject", claims.CertificateSubject()),
 			zap.String("time", time.Now().Format(time.RFC3339)),
 		)
 
@@ -193,9 +477,37 @@ func (ss *StreamServer) Events(es proto.StreamService_EventsServer) error {
 				events[i] = request.Events[i].Type
 			}
 		}
-		ss.resfreshEvents <- refreshEvents{
-			client: &client,
-			events: events,
+
+		if err := ss.validator.Validate(events); err != nil {
+			return grpc.Errorf(codes.InvalidArgument, "%s", err)
+		}
+
+		if ss.authorizer != nil {
+			var denied []string
+			events, denied = auth.Filter(ss.authorizer, claims, events)
+			if len(denied) != 0 {
+				ss.errorLogger.Info("denied to subscribe events",
+					zap.String("subject", claims.Subject()),
+					zap.Strings("events", denied),
+				)
+				if ss.config.Auth.Authorization.DeniedBehavior.Type != config.DeniedBehaviorDrop {
+					return grpc.Errorf(codes.PermissionDenied, "not allowed to subscribe: %s", strings.Join(denied, ","))
+				}
+				// NOTE: wait for the report not to end the stream before the trailer is set
+				r := deniedReport{events: denied, reported: make(chan struct{})}
+				select {
+				case deniedCh <- r:
+					<-r.reported
+				case <-client.Closed():
+					return nil
+				}
+			}
+		}
+		summary.setEvents(events)
+		ss.clientUpdates <- clientUpdate{
+			updateType: refreshClient,
+			client:     *client,
+			events:     events,
 		}
 	}
 }
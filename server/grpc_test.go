@@ -13,6 +13,7 @@ import (
 
 	"google.golang.org/grpc"
 
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/log"
 	"github.com/openfresh/plasma/pubsub"
@@ -180,3 +181,109 @@ func TestGRPCEvents(t *testing.T) {
 		assert.Equal(c.expectCount, c.actualCount)
 	}
 }
+
+func TestGRPCDeniedEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pb := pubsub.NewPubSub()
+
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(err)
+
+	authorizer, err := auth.NewAuthorizer(config.Authorization{
+		Type:      auth.ClaimsPolicy,
+		Claim:     "events",
+		Protected: []string{"program:premium"},
+	})
+	require.NoError(err)
+
+	c := config.Config{}
+	c.Auth.Authorization.DeniedBehavior.Type = config.DeniedBehaviorDrop
+	grpcServer, err := NewGRPCServer(Option{
+		PubSuber:     pb,
+		Authorizer:   authorizer,
+		AccessLogger: logger,
+		ErrorLogger:  logger,
+		Config:       c,
+	})
+	require.NoError(err)
+	defer grpcServer.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	go grpcServer.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure(), grpc.WithTimeout(5*time.Second))
+	require.NoError(err)
+	defer conn.Close()
+	ss, err := proto.NewStreamServiceClient(conn).Events(context.Background())
+	require.NoError(err)
+
+	// NOTE: the denied events before the first payload are reported by the header
+	require.NoError(ss.Send(&proto.Request{Events: []*proto.EventType{
+		eventType("program:free:1"),
+		eventType("program:premium:1"),
+	}}))
+	received := make(chan error, 1)
+	go func() {
+		_, err := ss.Recv()
+		received <- err
+	}()
+	func() {
+		for {
+			pb.Publish(event.Payload{
+				Meta: event.MetaData{Type: "program:free:1"},
+				Data: json.RawMessage(`{}`),
+			})
+			select {
+			case err := <-received:
+				require.NoError(err)
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	header, err := ss.Header()
+	require.NoError(err)
+	assert.Equal([]string{"program:premium:1"}, header[deniedEventsMetadata])
+
+	// NOTE: the denied events after the first payload are reported by the trailer
+	require.NoError(ss.Send(&proto.Request{Events: []*proto.EventType{
+		eventType("program:free:1"),
+		eventType("program:premium:2"),
+	}}))
+	require.NoError(ss.Send(&proto.Request{ForceClose: true}))
+	for {
+		if _, err := ss.Recv(); err != nil {
+			break
+		}
+	}
+	assert.Equal([]string{"program:premium:2"}, ss.Trailer()[deniedEventsMetadata])
+}
+
+func TestChainStreamInterceptors(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls []string
+	interceptor := func(name string) grpc.StreamServerInterceptor {
+		return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			calls = append(calls, name+":before")
+			err := handler(srv, ss)
+			calls = append(calls, name+":after")
+			return err
+		}
+	}
+
+	chained := chainStreamInterceptors(interceptor("first"), interceptor("second"))
+	err := chained(nil, nil, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	assert.NoError(err)
+	assert.Equal([]string{"first:before", "second:before", "handler", "second:after", "first:after"}, calls)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Pinger is a loop which can report whether it is responsive.
+type Pinger interface {
+	Ping(timeout time.Duration) error
+}
+
+var errNotResponsive = errors.New("fan-out loop is not responsive")
+
+// ping succeeds if the loop receives from the channel within the timeout.
+func ping(pings chan<- struct{}, timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case pings <- struct{}{}:
+		return nil
+	case <-t.C:
+		return errNotResponsive
+	}
+}
+
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+type check struct {
+	name string
+	run  func() error
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// runChecks runs all checks and returns the status code and the body describing each check.
+func runChecks(checks []check) (int, healthResponse) {
+	res := healthResponse{
+		Status: healthOK,
+		Checks: make(map[string]checkResult, len(checks)),
+	}
+	for _, c := range checks {
+		if err := c.run(); err != nil {
+			res.Status = healthFail
+			res.Checks[c.name] = checkResult{Status: healthFail, Error: err.Error()}
+			continue
+		}
+		res.Checks[c.name] = checkResult{Status: healthOK}
+	}
+
+	if res.Status != healthOK {
+		return http.StatusServiceUnavailable, res
+	}
+	return http.StatusOK, res
+}
+
+func writeHealth(w http.ResponseWriter, checks []check) int {
+	status, res := runChecks(checks)
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	w.Write(b)
+	return status
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
+	"github.com/pkg/errors"
 )
 
 type metaHandler struct {
@@ -19,6 +21,8 @@ type metaHandler struct {
 	config       config.Config
 	mux          *http.ServeMux
 	redisClient  *redis.Client
+	liveness     []check
+	readiness    []check
 }
 
 func (h metaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -26,34 +30,55 @@ func (h metaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func NewMetaHandler(opt Option) metaHandler {
-
-	redisConf := opt.Config.Subscriber.Redis
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisConf.Addr,
-		Password: redisConf.Password,
-		DB:       redisConf.DB,
-	})
-
 	h := metaHandler{
 		accessLogger: opt.AccessLogger,
 		errorLogger:  opt.ErrorLogger,
 		config:       opt.Config,
 		mux:          http.NewServeMux(),
-		redisClient:  redisClient,
+	}
+
+	// NOTE: the process is restarted if the liveness probe fails, so it doesn't depend on Redis
+	for name, p := range opt.FanOuts {
+		p := p
+		h.liveness = append(h.liveness, check{name: "fanout_" + name, run: func() error {
+			return p.Ping(opt.Config.Health.FanOutTimeout)
+		}})
+	}
+	if opt.Subscriber != nil {
+		h.readiness = append(h.readiness, check{name: "subscriber", run: opt.Subscriber.Health})
+	}
+	h.readiness = append(h.readiness, check{name: "draining", run: func() error {
+		if opt.Drainer.Draining() {
+			return errors.New("draining connections")
+		}
+		return nil
+	}})
+	if opt.Limiter != nil {
+		h.readiness = append(h.readiness, check{name: "connections", run: func() error {
+			if opt.Limiter.Full() {
+				return limit.ErrTooManyConnections
+			}
+			return nil
+		}})
 	}
 
 	if h.config.Debug {
+		redisConf := opt.Config.Subscriber.Redis
+		h.redisClient = redis.NewClient(&redis.Options{
+			Addr:     redisConf.Addr,
+			Password: redisConf.Password.Value(),
+			DB:       redisConf.DB,
+		})
 		h.mux.HandleFunc("/debug", h.debug)
 	}
-	h.mux.HandleFunc("/hc", h.healthCheck)
+	h.mux.HandleFunc("/healthz", h.healthz)
+	h.mux.HandleFunc("/readyz", h.readyz)
+	// Deprecated: use /readyz
+	h.mux.HandleFunc("/hc", h.readyz)
 
 	return h
 }
 
-func (h *metaHandler) checkRedis() error {
-	return h.redisClient.Ping().Err()
-}
-
 func (h *metaHandler) debug(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -94,19 +119,17 @@ func (h *metaHandler) debug(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (h *metaHandler) healthCheck(w http.ResponseWriter, r *http.Request) {
-	status := http.StatusOK
-	if h.config.Subscriber.Type == "redis" {
-		if err := h.checkRedis(); err != nil {
-			h.errorLogger.Error("failed to connect redis",
-				zap.Error(err),
-				zap.Object("redis", h.config.Subscriber.Redis),
-			)
-			status = http.StatusInternalServerError
-		}
-	}
+// healthz reports whether the process is alive.
+func (h *metaHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	status := writeHealth(w, h.liveness)
+
+	fields := append(log.HTTPRequestToLogFields(r), zap.Int("status", status))
+	h.accessLogger.Info("healthCheck", fields...)
+}
 
-	w.WriteHeader(status)
+// readyz reports whether the server can accept new clients.
+func (h *metaHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	status := writeHealth(w, h.readiness)
 
 	fields := append(log.HTTPRequestToLogFields(r), zap.Int("status", status))
 	h.accessLogger.Info("healthCheck", fields...)
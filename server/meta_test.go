@@ -1,57 +1,44 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 )
 
-func TestCheckRedis(t *testing.T) {
-	assert := assert.New(t)
+type fakeSubscriber struct {
+	health error
+}
 
-	cases := []struct {
-		Redis config.Redis
-		IsErr bool
-	}{
-		{
-			Redis: config.Redis{
-				Addr:     "localhost:6379",
-				DB:       0,
-				Password: "",
-			},
-			IsErr: false,
-		},
-		{
-			Redis: config.Redis{
-				Addr:     "fakehost:6379",
-				DB:       0,
-				Password: "",
-			},
-			IsErr: true,
-		},
-	}
+func (s fakeSubscriber) Subscribe() error {
+	return nil
+}
 
-	for _, c := range cases {
-		h := NewMetaHandler(Option{
-			Config: config.Config{
-				Subscriber: config.Subscriber{
-					Redis: c.Redis,
-				},
-			},
-		})
-
-		err := h.checkRedis()
-		if c.IsErr {
-			assert.NotNil(err)
-		} else {
-			assert.Nil(err)
-		}
-	}
+func (s fakeSubscriber) Health() error {
+	return s.health
+}
+
+func (s fakeSubscriber) Reload(config.Config) error {
+	return nil
+}
+
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) Ping(time.Duration) error {
+	return p.err
 }
 
 func TestHealthCheckHandler(t *testing.T) {
@@ -59,51 +46,96 @@ func TestHealthCheckHandler(t *testing.T) {
 	l, err := log.NewLogger(config.Log{
 		Out: "discard",
 	})
-	assert.Nil(err)
+	require.NoError(t, err)
+
+	drainer := NewDrainer(config.Drain{}, l)
+	drainer.Drain(context.Background())
+
+	full := limit.New(config.Limit{MaxConnections: 1})
+	require.NoError(t, full.Acquire(limit.SSE, "10.0.0.1"))
 
 	cases := []struct {
-		Redis config.Redis
-		IsErr bool
+		name   string
+		option Option
+		path   string
+		status int
+		checks map[string]string
 	}{
 		{
-			Redis: config.Redis{
-				Addr:     "localhost:6379",
-				DB:       0,
-				Password: "",
-			},
-			IsErr: false,
+			name:   "alive",
+			option: Option{FanOuts: map[string]Pinger{"sse": fakePinger{}}},
+			path:   "/healthz",
+			status: http.StatusOK,
+			checks: map[string]string{"fanout_sse": healthOK},
 		},
 		{
-			Redis: config.Redis{
-				Addr:     "fakehost:6379",
-				DB:       0,
-				Password: "",
-			},
-			IsErr: true,
+			name:   "fan-out loop is blocked",
+			option: Option{FanOuts: map[string]Pinger{"sse": fakePinger{}, "grpc": fakePinger{err: errNotResponsive}}},
+			path:   "/healthz",
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"fanout_sse": healthOK, "fanout_grpc": healthFail},
+		},
+		{
+			name:   "liveness doesn't depend on the subscriber",
+			option: Option{Subscriber: fakeSubscriber{health: errors.New("redis is down")}},
+			path:   "/healthz",
+			status: http.StatusOK,
+			checks: map[string]string{},
+		},
+		{
+			name:   "ready",
+			option: Option{Subscriber: fakeSubscriber{}, Limiter: limit.New(config.Limit{})},
+			path:   "/readyz",
+			status: http.StatusOK,
+			checks: map[string]string{"subscriber": healthOK, "draining": healthOK, "connections": healthOK},
+		},
+		{
+			name:   "subscriber is disconnected",
+			option: Option{Subscriber: fakeSubscriber{health: errors.New("redis is down")}},
+			path:   "/readyz",
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"subscriber": healthFail, "draining": healthOK},
+		},
+		{
+			name:   "draining",
+			option: Option{Drainer: drainer},
+			path:   "/readyz",
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"draining": healthFail},
+		},
+		{
+			name:   "connection limit is reached",
+			option: Option{Limiter: full},
+			path:   "/readyz",
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"draining": healthOK, "connections": healthFail},
+		},
+		{
+			name:   "deprecated endpoint",
+			option: Option{Subscriber: fakeSubscriber{health: errors.New("redis is down")}},
+			path:   "/hc",
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"subscriber": healthFail, "draining": healthOK},
 		},
 	}
 
 	for _, c := range cases {
-		handler := NewMetaHandler(Option{
-			AccessLogger: l,
-			ErrorLogger:  l,
-			Config: config.Config{
-				Subscriber: config.Subscriber{
-					Type:  "redis",
-					Redis: c.Redis,
-				},
-			},
-		})
-
-		req, err := http.NewRequest("GET", "/hc", nil)
-		assert.Nil(err)
+		c.option.AccessLogger = l
+		c.option.ErrorLogger = l
+		handler := NewMetaHandler(c.option)
+
+		req, err := http.NewRequest("GET", c.path, nil)
+		require.NoError(t, err)
 		rec := httptest.NewRecorder()
 		handler.ServeHTTP(rec, req)
 
-		if c.IsErr {
-			assert.Equal(http.StatusInternalServerError, rec.Code)
-		} else {
-			assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal(c.status, rec.Code, c.name)
+		var res healthResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res), c.name)
+		checks := make(map[string]string)
+		for name, r := range res.Checks {
+			checks[name] = r.Status
 		}
+		assert.Equal(c.checks, checks, c.name)
 	}
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/openfresh/plasma/config"
@@ -8,10 +9,16 @@ import (
 	"go.uber.org/zap"
 )
 
+// ClusterStatser returns the stats of the live nodes of the cluster. ex) *cluster.Cluster
+type ClusterStatser interface {
+	Stats() (*metrics.ClusterStats, error)
+}
+
 type metricsHandler struct {
 	accessLogger *zap.Logger
 	errorLogger  *zap.Logger
 	config       config.Config
+	cluster      ClusterStatser
 	mux          *http.ServeMux
 }
 
@@ -25,11 +32,15 @@ func NewMetricsHandler(opt Option) metricsHandler {
 		accessLogger: opt.AccessLogger,
 		errorLogger:  opt.ErrorLogger,
 		config:       opt.Config,
+		cluster:      opt.Cluster,
 		mux:          http.NewServeMux(),
 	}
 
 	h.mux.HandleFunc("/metrics/go", h.metricsGo)
 	h.mux.HandleFunc("/metrics/plasma", h.metricsPlasma)
+	h.mux.HandleFunc("/metrics/events", h.metricsEvents)
+	h.mux.HandleFunc("/metrics/cluster", h.metricsCluster)
+	h.mux.HandleFunc("/metrics", h.metricsPrometheus)
 	return h
 }
 
@@ -40,3 +51,43 @@ func (h *metricsHandler) metricsGo(w http.ResponseWriter, r *http.Request) {
 func (h *metricsHandler) metricsPlasma(w http.ResponseWriter, r *http.Request) {
 	metrics.PlasmaStatsHandler(w, r)
 }
+
+func (h *metricsHandler) metricsEvents(w http.ResponseWriter, r *http.Request) {
+	metrics.EventStatsHandler(w, r)
+}
+
+func (h *metricsHandler) metricsCluster(w http.ResponseWriter, r *http.Request) {
+	if h.cluster == nil {
+		http.Error(w, "cluster is disabled", http.StatusNotFound)
+		return
+	}
+	s, err := h.cluster.Stats()
+	if err != nil {
+		h.errorLogger.Error("failed to get cluster stats",
+			zap.Error(err),
+		)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *metricsHandler) metricsPrometheus(w http.ResponseWriter, r *http.Request) {
+	metrics.PrometheusHandler(w, r)
+	if h.cluster == nil {
+		return
+	}
+	// NOTE: the metrics of this node are still useful even if the cluster stats aren't available
+	s, err := h.cluster.Stats()
+	if err != nil {
+		h.errorLogger.Error("failed to get cluster stats",
+			zap.Error(err),
+		)
+		return
+	}
+	metrics.WriteClusterPrometheus(w, s)
+}
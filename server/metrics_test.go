@@ -1,12 +1,15 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/metrics"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,3 +72,133 @@ func TestMetricsPlasma(t *testing.T) {
 
 	assert.Equal(http.StatusOK, rec.Code)
 }
+
+func TestMetricsPrometheus(t *testing.T) {
+	assert := assert.New(t)
+	l, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	assert.Nil(err)
+
+	handler := NewMetricsHandler(Option{
+		AccessLogger: l,
+		ErrorLogger:  l,
+		Config:       config.Config{},
+	})
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	assert.Nil(err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Header().Get("Content-Type"), "text/plain")
+
+	body := rec.Body.String()
+	assert.Contains(body, "# TYPE go_goroutines gauge\n")
+	assert.Contains(body, "# TYPE plasma_payloads_received_total counter\n")
+	assert.Contains(body, `plasma_connections{transport="sse"} `)
+	assert.Contains(body, `plasma_connects_total{transport="grpc"} `)
+	assert.Contains(body, "# TYPE plasma_delivery_latency_seconds summary\n")
+	assert.Contains(body, `plasma_delivery_latency_seconds{stage="enqueue_to_write",quantile="0.99"} `)
+	assert.Contains(body, `plasma_delivery_latency_seconds_count{stage="publish_to_ingest"} `)
+}
+
+func TestMetricsEvents(t *testing.T) {
+	assert := assert.New(t)
+	l, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	assert.Nil(err)
+
+	handler := NewMetricsHandler(Option{
+		AccessLogger: l,
+		ErrorLogger:  l,
+		Config:       config.Config{},
+	})
+
+	// NOTE: the stats are global, so the delta is asserted not to depend on the other runs
+	before := metrics.GetEventStats().EventTypes["metrics-test:1"].Published
+	metrics.IncEventPublished("metrics-test:1:views")
+
+	req, err := http.NewRequest("GET", "/metrics/events", nil)
+	assert.Nil(err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusOK, rec.Code)
+
+	var stats metrics.EventStats
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&stats))
+	assert.Equal(before+1, stats.EventTypes["metrics-test:1"].Published)
+}
+
+type fakeCluster struct {
+	stats *metrics.ClusterStats
+	err   error
+}
+
+func (c fakeCluster) Stats() (*metrics.ClusterStats, error) {
+	return c.stats, c.err
+}
+
+func TestMetricsCluster(t *testing.T) {
+	assert := assert.New(t)
+	l, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	assert.Nil(err)
+
+	stats := metrics.NewClusterStats([]metrics.NodeStats{
+		{ID: "node2", Connections: 3, ConnectionsGRPC: 3, Subscribers: map[string]int64{"program:1234": 1}},
+		{ID: "node1", Connections: 2, ConnectionsSSE: 2, Subscribers: map[string]int64{"program:1234": 2}},
+	})
+
+	cases := []struct {
+		cluster    ClusterStatser
+		expectCode int
+	}{
+		{cluster: nil, expectCode: http.StatusNotFound},
+		{cluster: fakeCluster{err: errors.New("redis is down")}, expectCode: http.StatusServiceUnavailable},
+		{cluster: fakeCluster{stats: stats}, expectCode: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		handler := NewMetricsHandler(Option{
+			AccessLogger: l,
+			ErrorLogger:  l,
+			Config:       config.Config{},
+			Cluster:      c.cluster,
+		})
+
+		req, err := http.NewRequest("GET", "/metrics/cluster", nil)
+		assert.Nil(err)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(c.expectCode, rec.Code)
+
+		req, err = http.NewRequest("GET", "/metrics", nil)
+		assert.Nil(err)
+		prom := httptest.NewRecorder()
+		handler.ServeHTTP(prom, req)
+		assert.Equal(http.StatusOK, prom.Code)
+
+		if c.expectCode != http.StatusOK {
+			assert.NotContains(prom.Body.String(), "plasma_cluster_nodes")
+			continue
+		}
+
+		var actual metrics.ClusterStats
+		assert.NoError(json.NewDecoder(rec.Body).Decode(&actual))
+		assert.Equal(2, actual.NodeNum)
+		assert.Equal(int64(5), actual.Connections)
+		assert.Equal(int64(3), actual.Subscribers["program:1234"])
+		assert.Equal("node1", actual.Nodes[0].ID)
+
+		body := prom.Body.String()
+		assert.Contains(body, "plasma_cluster_nodes 2\n")
+		assert.Contains(body, `plasma_cluster_connections{transport="grpc"} 3`+"\n")
+		assert.Contains(body, `plasma_cluster_node_connections{node="node1"} 2`+"\n")
+		assert.Contains(body, `plasma_cluster_event_subscribers{event_type="program:1234"} 3`+"\n")
+	}
+}
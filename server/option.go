@@ -1,14 +1,29 @@
 package server
 
 import (
+	"crypto/tls"
+
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/limit"
+	"github.com/openfresh/plasma/manager"
 	"github.com/openfresh/plasma/pubsub"
+	"github.com/openfresh/plasma/subscriber"
 	"go.uber.org/zap"
 )
 
 type Option struct {
-	PubSuber     pubsub.PubSuber
-	AccessLogger *zap.Logger
-	ErrorLogger  *zap.Logger
-	Config       config.Config
+	PubSuber      pubsub.PubSuber
+	AccessLogger  *zap.Logger
+	ErrorLogger   *zap.Logger
+	Config        config.Config
+	Authenticator auth.Authenticator
+	Authorizer    auth.Authorizer
+	TLSConfig     *tls.Config
+	Limiter       *limit.Limiter
+	Drainer       *Drainer
+	Subscriber    subscriber.Subscriber
+	FanOuts       map[string]Pinger
+	Cluster       ClusterStatser
+	Observer      manager.SubscriptionObserver
 }
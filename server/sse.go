@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,43 +13,73 @@ import (
 	"encoding/json"
 
 	"github.com/mssola/user_agent"
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
 	"github.com/openfresh/plasma/manager"
 	"github.com/openfresh/plasma/metrics"
 	"github.com/openfresh/plasma/pubsub"
+	"github.com/openfresh/plasma/trace"
 	"github.com/pkg/errors"
 )
 
 type sseHandler struct {
 	clientManager *manager.ClientManager
-	timer         *time.Ticker
+	heartbeat     time.Duration
+	heartbeats    chan time.Duration
 	newClients    chan manager.Client
 	removeClients chan manager.Client
 	payloads      chan event.Payload
+	pings         chan struct{}
 	pubsub        pubsub.PubSuber
-	retry         int
+	// NOTE: retry is shared between copies of the handler because it can be changed by Reload
+	retry         *int64
 	eventQuery    string
+	authenticator auth.Authenticator
+	authorizer    auth.Authorizer
+	limiter       *limit.Limiter
+	drainer       *Drainer
+	validator     *event.Validator
 	accessLogger  *zap.Logger
 	errorLogger   *zap.Logger
 	config        config.Config
 }
 
 func NewSSEHandler(opt Option) (sseHandler, error) {
+	validator, err := event.NewValidator(opt.Config.Subscription)
+	if err != nil {
+		return sseHandler{}, err
+	}
+	heartbeat := opt.Config.SSE.HeartbeatInterval
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeatInterval
+	}
+	retry := int64(opt.Config.SSE.Retry)
 	h := sseHandler{
-		clientManager: manager.NewClientManager(),
-		timer:         time.NewTicker(10 * time.Second),
+		heartbeat:     heartbeat,
+		heartbeats:    make(chan time.Duration),
 		newClients:    make(chan manager.Client),
 		removeClients: make(chan manager.Client),
 		payloads:      make(chan event.Payload),
+		pings:         make(chan struct{}),
 		pubsub:        opt.PubSuber,
-		retry:         opt.Config.SSE.Retry,
+		retry:         &retry,
 		eventQuery:    opt.Config.SSE.EventQuery,
+		authenticator: opt.Authenticator,
+		authorizer:    opt.Authorizer,
+		limiter:       opt.Limiter,
+		drainer:       opt.Drainer,
+		validator:     validator,
 		accessLogger:  opt.AccessLogger,
 		errorLogger:   opt.ErrorLogger,
 		config:        opt.Config,
 	}
+	h.clientManager = manager.NewClientManagerWithOption(manager.Option{
+		Observer: opt.Observer,
+		Encoder:  h.encode,
+	})
 	if err := h.pubsub.Subscribe(func(payload event.Payload) {
 		h.payloads <- payload
 	}); err != nil {
@@ -59,10 +90,39 @@ func NewSSEHandler(opt Option) (sseHandler, error) {
 	return h, nil
 }
 
-const heartBeatEvent = "heartbeat"
+const (
+	heartBeatEvent           = "heartbeat"
+	defaultHeartbeatInterval = 10 * time.Second
+)
+
+// deniedEventsHeader reports event types dropped by the authorizer.
+const deniedEventsHeader = "X-Plasma-Denied-Events"
+
+// ClientManager returns the clients connected via SSE.
+func (h sseHandler) ClientManager() *manager.ClientManager {
+	return h.clientManager
+}
+
+// Ping checks that the fan-out loop is responsive.
+func (h sseHandler) Ping(timeout time.Duration) error {
+	return ping(h.pings, timeout)
+}
+
+// Reload applies the retry and the heartbeat interval to the handler without dropping clients.
+func (h sseHandler) Reload(config config.ServerSentEvent) {
+	atomic.StoreInt64(h.retry, int64(config.Retry))
+	if config.HeartbeatInterval > 0 {
+		h.heartbeats <- config.HeartbeatInterval
+	}
+}
+
+func (h sseHandler) retryMillis() int {
+	return int(atomic.LoadInt64(h.retry))
+}
 
 func (h sseHandler) Run() {
 	go func() {
+		timer := time.NewTicker(h.heartbeat)
 		for {
 			select {
 			case client := <-h.newClients:
@@ -75,8 +135,12 @@ func (h sseHandler) Run() {
 				metrics.DecConnectionSSE()
 			case payload := <-h.payloads:
 				h.clientManager.SendPayload(payload)
-			case <-h.timer.C:
+			case <-timer.C:
 				h.clientManager.SendHeartBeat()
+			case d := <-h.heartbeats:
+				timer.Stop()
+				timer = time.NewTicker(d)
+			case <-h.pings:
 			}
 		}
 	}()
@@ -97,7 +161,7 @@ func isNotSupportSSE(u string) bool {
 	return false
 }
 
-func (h sseHandler) events(w http.ResponseWriter, r *http.Request) int {
+func (h sseHandler) events(w http.ResponseWriter, r *http.Request, summary *connSummary) int {
 	eventRequestsQuery, ok := r.URL.Query()[h.eventQuery]
 	if !ok {
 		http.Error(w, "specify event queries", http.StatusBadRequest)
@@ -128,58 +192,203 @@ func (h sseHandler) events(w http.ResponseWriter, r *http.Request) int {
 	// NOTE: eventRequestQuery[0] ex) 'program:1234:poll,program:1234:views'
 	eventRequests := strings.Split(eventRequestsQuery[0], ",")
 
+	if err := h.validator.Validate(eventRequests); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return http.StatusBadRequest
+	}
+
+	claims, _ := auth.FromContext(r.Context())
+	if h.authorizer != nil {
+		var denied []string
+		eventRequests, denied = auth.Filter(h.authorizer, claims, eventRequests)
+		if len(denied) != 0 {
+			h.errorLogger.Info("denied to subscribe events",
+				zap.String("subject", claims.Subject()),
+				zap.Strings("events", denied),
+			)
+			if h.config.Auth.Authorization.DeniedBehavior.Type != config.DeniedBehaviorDrop || len(eventRequests) == 0 {
+				http.Error(w, "not allowed to subscribe: "+strings.Join(denied, ","), http.StatusForbidden)
+				return http.StatusForbidden
+			}
+			w.Header().Set(deniedEventsHeader, strings.Join(denied, ","))
+		}
+	}
+
 	if isNotSupportSSE(r.UserAgent()) {
 		eventRequests = append(eventRequests, heartBeatEvent)
 	}
 
-	client := manager.NewClient(eventRequests)
+	client := manager.NewClientWithInfo(eventRequests, manager.ClientInfo{
+		Transport:  limit.SSE,
+		RemoteAddr: log.RemoteAddr(r),
+		UserAgent:  r.UserAgent(),
+		Subject:    claims.Subject(),
+	})
 	h.newClients <- client
+	summary.connect(client.ID(), eventRequests)
+	h.accessLogger.Info("sse connect", append(log.HTTPRequestToLogFields(r),
+		zap.String("client-id", client.ID()),
+		zap.Strings("events", eventRequests),
+	)...)
 	defer func() {
+		// NOTE: close the client first not to block SendPayload until it is removed
+		client.Close()
 		h.removeClients <- client
 	}()
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", h.config.Origin)
 
-	fmt.Fprintf(w, "retry: %d\n", h.retry)
+	fmt.Fprintf(w, "retry: %d\n", h.retryMillis())
+	f.Flush()
 
-	go func() {
-		for pl := range client.ReceivePayload() {
-			eventType := pl.Meta.Type
-			if eventType == heartBeatEvent {
-				// NOTE: if use IE or Edge, need to send "comment" messages each 15-30 seconds, these messages will be used as heartbeat to detect disconnects
-				// https://github.com/Yaffle/EventSource#server-side-requirements
-				fmt.Fprint(w, ":heartbeat \n\n")
+	closeNotify := w.(http.CloseNotifier).CloseNotify()
+	for {
+		select {
+		case <-closeNotify:
+			summary.close(closedByClient)
+			return http.StatusOK
+		case <-client.Closed():
+			// NOTE: disconnected by the admin API or draining
+			if h.drainer.Draining() {
+				summary.close(closedByDraining)
+				// NOTE: spread reconnections to other servers
+				retry := h.retryMillis() + int(h.drainer.RetryJitter()/time.Millisecond)
+				fmt.Fprintf(w, "retry: %d\n\n", retry)
 				f.Flush()
-				lastEventID++
-				continue
-			}
-			b, err := json.Marshal(pl)
-			if err != nil {
-				h.errorLogger.Error("failed to marshal event payload",
-					zap.Error(err),
-					zap.Object("payload", pl),
-				)
-				continue
+				return http.StatusOK
 			}
-			fmt.Fprintf(w, "id: %d\n", lastEventID)
-			fmt.Fprintf(w, "data: %s\n\n", string(b))
-			f.Flush()
+			summary.close(closedByServer)
+			return http.StatusOK
+		case pl := <-client.ReceivePayload():
+			h.write(w, f, pl, lastEventID, summary)
 			lastEventID++
 		}
-		w.WriteHeader(http.StatusOK)
-	}()
+	}
+}
 
-	<-w.(http.CloseNotifier).CloseNotify()
+func (h sseHandler) write(w http.ResponseWriter, f http.Flusher, pl event.Payload, lastEventID int, summary *connSummary) {
+	eventType := pl.Meta.Type
+	if eventType == heartBeatEvent {
+		// NOTE: if use IE or Edge, need to send "comment" messages each 15-30 seconds, these messages will be used as heartbeat to detect disconnects
+		// https://github.com/Yaffle/EventSource#server-side-requirements
+		fmt.Fprint(w, ":heartbeat \n\n")
+		f.Flush()
+		return
+	}
+	span := trace.Start("plasma.sse.write", trace.FromTraceparent(pl.Meta.Traceparent), trace.KindProducer)
+	defer span.End()
+	span.SetAttribute("plasma.event_type", eventType)
+	encoded := pl.Encoded
+	if encoded == nil {
+		var err error
+		if encoded, err = h.encode(pl); err != nil {
+			metrics.IncPayloadDropped()
+			summary.dropped()
+			span.SetError(err)
+			return
+		}
+	}
+	n1, _ := fmt.Fprintf(w, "id: %d\n", lastEventID)
+	n2, _ := w.Write(encoded.SSE)
+	f.Flush()
+	span.SetAttribute("plasma.bytes", n1+n2)
+	summary.sent(n1 + n2)
+	metrics.IncPayloadDelivered()
+	metrics.AddEventDelivered(eventType, n1+n2)
+	if !pl.EnqueuedAt.IsZero() {
+		metrics.ObserveEnqueueToWrite(time.Since(pl.EnqueuedAt))
+	}
+}
+
+// encode serializes the payload into the data field of the SSE frame, which is shared by all clients.
+// NOTE: the traceparent is removed not to expose the internal trace to clients
+func (h sseHandler) encode(pl event.Payload) (*event.Encoded, error) {
+	pl.Meta.Traceparent = ""
+	b, err := json.Marshal(pl)
+	if err != nil {
+		h.errorLogger.Error("failed to marshal event payload",
+			zap.Error(err),
+			zap.Object("payload", pl),
+		)
+		return nil, err
+	}
+	frame := make([]byte, 0, len(sseDataField)+len(b)+2)
+	frame = append(frame, sseDataField...)
+	frame = append(frame, b...)
+	frame = append(frame, "\n\n"...)
+	return &event.Encoded{SSE: frame}, nil
+}
+
+const sseDataField = "data: "
+
+func (h sseHandler) authenticate(r *http.Request) (*http.Request, error) {
+	claims := auth.FromTLS(r.TLS)
+	if h.authenticator != nil {
+		token, err := auth.TokenFromRequest(r, h.config.Auth.Query)
+		if err != nil {
+			return r, err
+		}
+		c, err := h.authenticator.Authenticate(token)
+		if err != nil {
+			return r, err
+		}
+		if claims, err = auth.WithCertificate(c, claims); err != nil {
+			return r, err
+		}
+	}
+	if claims == nil {
+		return r, nil
+	}
+	return r.WithContext(auth.NewContext(r.Context(), claims)), nil
+}
+
+func (h sseHandler) serve(w http.ResponseWriter, r *http.Request, summary *connSummary) (*http.Request, int) {
+	if h.drainer.Draining() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return r, http.StatusServiceUnavailable
+	}
+
+	if h.limiter != nil {
+		addr := log.RemoteAddr(r)
+		if err := h.limiter.Acquire(limit.SSE, addr); err != nil {
+			h.errorLogger.Info("failed to acquire a connection",
+				zap.Error(err),
+				zap.String("remote-addr", addr),
+			)
+			if err == limit.ErrRateLimited {
+				w.Header().Set("Retry-After", "1")
+			}
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return r, http.StatusTooManyRequests
+		}
+		defer h.limiter.Release(limit.SSE, addr)
+	}
+
+	r, err := h.authenticate(r)
+	if err != nil {
+		h.errorLogger.Info("failed to authenticate",
+			zap.Error(err),
+		)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return r, http.StatusUnauthorized
+	}
 
-	return http.StatusOK
+	return r, h.events(w, r, summary)
 }
 
 func (h sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	status := h.events(w, r)
+	start := time.Now()
+	summary := &connSummary{}
+	r, status := h.serve(w, r, summary)
 
-	fileds := append(log.HTTPRequestToLogFields(r), zap.Int("status", status))
+	fileds := append(log.HTTPRequestToLogFields(r),
+		zap.Int("status", status),
+		zap.Int64("duration", time.Since(start).Nanoseconds()/int64(time.Millisecond)),
+	)
+	fileds = append(fileds, summary.fields()...)
 	h.accessLogger.Info("sse", fileds...)
 }
@@ -7,14 +7,17 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/openfresh/plasma/auth"
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/limit"
 	"github.com/openfresh/plasma/log"
 	"github.com/openfresh/plasma/pubsub"
 
@@ -81,9 +84,9 @@ func TestSSEHandler(t *testing.T) {
 	assert := assert.New(t)
 	pb := pubsub.NewPubSub()
 
-	origin := "*.test.com"
-	handler := setUpSSEHandler(t, pb, origin)
-	server := httptest.NewServer(handler)
+	origin := "https://www.test.com"
+	handler := setUpSSEHandler(t, pb, "*.test.com")
+	server := httptest.NewServer(NewCORSHandler(Option{Config: handler.config}, handler))
 	defer server.Close()
 
 	events := []event.Payload{
@@ -155,7 +158,10 @@ func TestSSEHandler(t *testing.T) {
 			// create request
 			eventReq := strings.Join(cases[i].events, ",")
 			url := fmt.Sprintf("%s/events?eventType=%s", server.URL, eventReq)
-			resp, err := http.Get(url)
+			req, err := http.NewRequest("GET", url, nil)
+			require.NoError(t, err)
+			req.Header.Set("Origin", origin)
+			resp, err := http.DefaultClient.Do(req)
 			require.NoError(t, err)
 			defer resp.Body.Close()
 
@@ -234,3 +240,141 @@ func readData(t *testing.T, r io.Reader) []byte {
 
 	return []byte(data)
 }
+
+type fakeAuthenticator struct {
+	token string
+}
+
+func (a fakeAuthenticator) Authenticate(token string) (auth.Claims, error) {
+	if token != a.token {
+		return nil, auth.ErrInvalidToken
+	}
+	return auth.Claims{"sub": "user-1"}, nil
+}
+
+func TestSSEHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "*")
+	handler.authenticator = fakeAuthenticator{token: "valid"}
+	handler.config.Auth.Query = "token"
+
+	cases := []struct {
+		url           string
+		authorization string
+	}{
+		{url: "/?eventType=program"},
+		{url: "/?eventType=program&token=invalid"},
+		{url: "/?eventType=program", authorization: "Bearer invalid"},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.url, nil)
+		require.NoError(t, err)
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(http.StatusUnauthorized, rec.Code, c.url)
+	}
+}
+
+func TestSSEHandlerDeniedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	authorizer, err := auth.NewAuthorizer(config.Authorization{
+		Type:      auth.ClaimsPolicy,
+		Claim:     "events",
+		Protected: []string{"program:premium"},
+	})
+	require.NoError(t, err)
+
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "*")
+	handler.authorizer = authorizer
+
+	req, err := http.NewRequest("GET", "/?eventType=program:free:1,program:premium:1", nil)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	handler.config.Auth.Authorization.DeniedBehavior.Type = config.DeniedBehaviorDrop
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?eventType=program:free:1,program:premium:1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("program:premium:1", resp.Header.Get(deniedEventsHeader))
+}
+
+func TestSSEHandlerTooManyRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "*")
+	handler.limiter = limit.New(config.Limit{ConnectRate: 1, ConnectBurst: 1})
+
+	// consume the burst of the address
+	require.NoError(t, handler.limiter.Acquire(limit.SSE, "192.0.2.1"))
+
+	req, err := http.NewRequest("GET", "/?eventType=program", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal("1", rec.Header().Get("Retry-After"))
+}
+
+func TestSSEHandlerInvalidEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "*")
+	validator, err := event.NewValidator(config.Subscription{
+		MaxEvents:      2,
+		MaxEventLength: 32,
+		MaxDepth:       3,
+		AllowedChars:   "A-Za-z0-9_.-",
+	})
+	require.NoError(t, err)
+	handler.validator = validator
+
+	cases := []string{
+		"a,b,c",
+		"program:1234:poll:result",
+		"program::1234",
+		"program:<1234>",
+		"program,",
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", "/?eventType="+url.QueryEscape(c), nil)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(http.StatusBadRequest, rec.Code, c)
+	}
+}
+
+func TestSSEHandlerPing(t *testing.T) {
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "")
+	assert.NoError(t, handler.Ping(time.Second))
+}
+
+func TestSSEHandlerEncode(t *testing.T) {
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "")
+
+	// NOTE: the traceparent isn't exposed to clients
+	encoded, err := handler.encode(event.Payload{
+		Meta: event.MetaData{
+			Type:        "program:1234:views",
+			Traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Data: json.RawMessage(`{"views": 55301}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "data: {\"meta\":{\"type\":\"program:1234:views\"},\"data\":{\"views\":55301}}\n\n", string(encoded.SSE))
+}
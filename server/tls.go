@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/metrics"
+	"github.com/pkg/errors"
+)
+
+// certReloader reloads the certificate when the cert or key file is updated,
+// so that certificates can be rotated without dropping live streams.
+type certReloader struct {
+	certFile    string
+	keyFile     string
+	errorLogger *zap.Logger
+	mu          sync.RWMutex
+	cert        *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertReloader(c config.Cert, errorLogger *zap.Logger) (*certReloader, error) {
+	r := &certReloader{
+		certFile:    c.CertFile,
+		keyFile:     c.KeyFile,
+		errorLogger: errorLogger,
+	}
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	if c.ReloadInterval > 0 {
+		go r.watch(c.ReloadInterval)
+	}
+	return r, nil
+}
+
+func (r *certReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return modTime, errors.Wrapf(err, "failed to stat: %s", f)
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cer, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load key pair")
+	}
+	leaf, err := x509.ParseCertificate(cer.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to parse certificate")
+	}
+	cer.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cer
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	metrics.SetTLSCertExpiry(leaf.NotAfter)
+	r.errorLogger.Info("load TLS certificate",
+		zap.String("certFile", r.certFile),
+		zap.String("subject", leaf.Subject.CommonName),
+		zap.Time("notAfter", leaf.NotAfter),
+	)
+	return nil
+}
+
+func (r *certReloader) watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		modTime, err := r.lastModified()
+		if err != nil {
+			r.errorLogger.Error("failed to check TLS certificate",
+				zap.Error(err),
+			)
+			continue
+		}
+		r.mu.RLock()
+		updated := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+		if !updated {
+			continue
+		}
+		// NOTE: keep the current certificate if the new one is broken, e.g. the key file isn't updated yet.
+		// It will be retried on the next tick.
+		if err := r.load(modTime); err != nil {
+			r.errorLogger.Error("failed to reload TLS certificate",
+				zap.Error(err),
+				zap.String("certFile", r.certFile),
+				zap.String("keyFile", r.keyFile),
+			)
+		}
+	}
+}
+
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func clientAuthType(c config.Cert) (tls.ClientAuthType, error) {
+	switch c.ClientAuth.Type {
+	case "":
+		// NOTE: verify client certificates by default if client CA is specified
+		if c.ClientCAFile != "" {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case config.ClientAuthNone:
+		return tls.NoClientCert, nil
+	case config.ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case config.ClientAuthRequire:
+		return tls.RequireAnyClientCert, nil
+	case config.ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case config.ClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth type: %s", c.ClientAuth.Type)
+}
+
+// NewTLSConfig creates TLS config shared by the HTTPS and gRPC listeners.
+// The certificate is reloaded in place when the files are updated.
+func NewTLSConfig(c config.Cert, errorLogger *zap.Logger) (*tls.Config, error) {
+	clientAuth, err := clientAuthType(c)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		ClientAuth: clientAuth,
+	}
+
+	if c.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read client CA file: %s", c.ClientCAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates in client CA file: %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && tlsConfig.ClientCAs == nil {
+		return nil, errors.New("client CA file is required to verify client certificates")
+	}
+
+	reloader, err := newCertReloader(c, errorLogger)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/auth"
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/openfresh/plasma/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func (c testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{c.cert.Raw},
+		PrivateKey:  c.key,
+	}
+}
+
+var serialNumber int64
+
+func createTestCert(t *testing.T, dir, name string, parent *testCert, isCA bool) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serialNumber++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"plasma"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return c
+}
+
+type subjectAuthorizer struct {
+	subject string
+}
+
+func (a subjectAuthorizer) Authorize(claims auth.Claims, _ string) bool {
+	return claims.Subject() == a.subject
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "plasma-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, dir, "ca", nil, true)
+	srv := createTestCert(t, dir, "server", &ca, false)
+
+	cases := []struct {
+		cert       config.Cert
+		clientAuth tls.ClientAuthType
+		isErr      bool
+	}{
+		{
+			cert:       config.Cert{CertFile: srv.certFile, KeyFile: srv.keyFile},
+			clientAuth: tls.NoClientCert,
+		},
+		{
+			cert:       config.Cert{CertFile: srv.certFile, KeyFile: srv.keyFile, ClientCAFile: ca.certFile},
+			clientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{
+			cert: config.Cert{
+				CertFile:     srv.certFile,
+				KeyFile:      srv.keyFile,
+				ClientCAFile: ca.certFile,
+				ClientAuth:   config.ClientAuth{Type: config.ClientAuthVerifyIfGiven},
+			},
+			clientAuth: tls.VerifyClientCertIfGiven,
+		},
+		{
+			cert: config.Cert{
+				CertFile:   srv.certFile,
+				KeyFile:    srv.keyFile,
+				ClientAuth: config.ClientAuth{Type: config.ClientAuthRequireAndVerify},
+			},
+			isErr: true,
+		},
+	}
+
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+
+	for _, c := range cases {
+		tlsConfig, err := NewTLSConfig(c.cert, logger)
+		if c.isErr {
+			assert.Error(err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(c.clientAuth, tlsConfig.ClientAuth)
+	}
+}
+
+func TestSSEHandlerMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "plasma-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, dir, "ca", nil, true)
+	srv := createTestCert(t, dir, "server", &ca, false)
+	client := createTestCert(t, dir, "client-1", &ca, false)
+	other := createTestCert(t, dir, "client-2", &ca, false)
+
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+
+	tlsConfig, err := NewTLSConfig(config.Cert{
+		CertFile:     srv.certFile,
+		KeyFile:      srv.keyFile,
+		ClientCAFile: ca.certFile,
+	}, logger)
+	require.NoError(t, err)
+
+	handler := setUpSSEHandler(t, pubsub.NewPubSub(), "*")
+	handler.authorizer = subjectAuthorizer{subject: "client-1"}
+
+	// NOTE: StartTLS overrides certificates, so the listener is wrapped directly
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = tls.NewListener(server.Listener, tlsConfig)
+	server.Start()
+	defer server.Close()
+	url := strings.Replace(server.URL, "http://", "https://", 1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	cases := []struct {
+		certs  []tls.Certificate
+		status int
+		isErr  bool
+	}{
+		{certs: []tls.Certificate{client.tlsCertificate()}, status: http.StatusOK},
+		{certs: []tls.Certificate{other.tlsCertificate()}, status: http.StatusForbidden},
+		{certs: nil, isErr: true},
+	}
+
+	for _, c := range cases {
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:      roots,
+					Certificates: c.certs,
+				},
+			},
+		}
+		resp, err := httpClient.Get(url + "/?eventType=program")
+		if c.isErr {
+			assert.Error(err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(c.status, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "plasma-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+
+	ca := createTestCert(t, dir, "ca", nil, true)
+	first := createTestCert(t, dir, "server", &ca, false)
+
+	r, err := newCertReloader(config.Cert{
+		CertFile:       first.certFile,
+		KeyFile:        first.keyFile,
+		ReloadInterval: 10 * time.Millisecond,
+	}, logger)
+	require.NoError(t, err)
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(first.cert.Raw, cert.Certificate[0])
+
+	// rotate the certificate
+	second := createTestCert(t, dir, "server", &ca, false)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(second.certFile, future, future))
+	require.NoError(t, os.Chtimes(second.keyFile, future, future))
+
+	for i := 0; i < 100; i++ {
+		cert, err = r.GetCertificate(nil)
+		require.NoError(t, err)
+		if string(cert.Certificate[0]) == string(second.cert.Raw) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(second.cert.Raw, cert.Certificate[0])
+	assert.Equal(second.cert.NotAfter.Unix(), cert.Leaf.NotAfter.Unix())
+}
@@ -0,0 +1,113 @@
+package subscriber
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openfresh/plasma/presence"
+)
+
+const eventSeparator = ":"
+
+// NOTE: these event types are published by plasma itself, so they aren't subscribed upstream
+var localEventTypes = []string{"heartbeat", presence.EventPrefix}
+
+func isLocalEventType(eventType string) bool {
+	for _, e := range localEventTypes {
+		if eventType == e || strings.HasPrefix(eventType, e+eventSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// interest counts the local subscribers of the event types. It is notified by the client managers,
+// and changed is signaled when an event type gets the first subscriber or loses the last one.
+type interest struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	changed chan struct{}
+}
+
+func newInterest() *interest {
+	return &interest{
+		counts:  make(map[string]int),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (i *interest) Join(eventType string) {
+	if isLocalEventType(eventType) {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.counts[eventType]++
+	if i.counts[eventType] == 1 {
+		i.notify()
+	}
+}
+
+func (i *interest) Leave(eventType string) {
+	if isLocalEventType(eventType) {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.counts[eventType]--
+	if i.counts[eventType] <= 0 {
+		delete(i.counts, eventType)
+		i.notify()
+	}
+}
+
+// notify doesn't block because the change is read from counts, not from the channel.
+func (i *interest) notify() {
+	select {
+	case i.changed <- struct{}{}:
+	default:
+	}
+}
+
+// eventTypes returns the sorted event types to subscribe. The descendants of the other event types are omitted
+// because their payloads are received by the ancestors, ex) program:1234 is omitted if program is subscribed.
+func (i *interest) eventTypes() []string {
+	i.mu.Lock()
+	set := make(map[string]struct{}, len(i.counts))
+	for e := range i.counts {
+		set[e] = struct{}{}
+	}
+	i.mu.Unlock()
+
+	eventTypes := make([]string, 0, len(set))
+	for e := range set {
+		if !hasAncestor(set, e) {
+			eventTypes = append(eventTypes, e)
+		}
+	}
+	sort.Strings(eventTypes)
+	return eventTypes
+}
+
+func hasAncestor(set map[string]struct{}, eventType string) bool {
+	for idx := strings.LastIndex(eventType, eventSeparator); idx > 0; idx = strings.LastIndex(eventType, eventSeparator) {
+		eventType = eventType[:idx]
+		if _, ok := set[eventType]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+var globReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// interestChannels returns the channel of the event type and the pattern of its descendants.
+// ex) plasma:program:1234 and plasma:program:1234:*
+func interestChannels(prefix string, eventTypes []string) (channels, patterns []string) {
+	for _, e := range eventTypes {
+		channels = append(channels, prefix+e)
+		patterns = append(patterns, globReplacer.Replace(prefix+e)+eventSeparator+"*")
+	}
+	return channels, patterns
+}
@@ -0,0 +1,51 @@
+package subscriber
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func changed(i *interest) bool {
+	select {
+	case <-i.changed:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestInterest(t *testing.T) {
+	assert := assert.New(t)
+
+	i := newInterest()
+	i.Join("program:1234")
+	assert.True(changed(i))
+	// NOTE: the second subscriber doesn't change the subscriptions
+	i.Join("program:1234")
+	assert.False(changed(i))
+	i.Join("program:1234:views")
+	i.Join("news")
+	i.Join("heartbeat")
+	i.Join("presence:program:1234")
+	assert.True(changed(i))
+	assert.Equal([]string{"news", "program:1234"}, i.eventTypes())
+
+	i.Leave("program:1234")
+	assert.False(changed(i))
+	i.Leave("program:1234")
+	assert.True(changed(i))
+	assert.Equal([]string{"news", "program:1234:views"}, i.eventTypes())
+
+	i.Join("program")
+	assert.True(changed(i))
+	assert.Equal([]string{"news", "program"}, i.eventTypes())
+}
+
+func TestInterestChannels(t *testing.T) {
+	assert := assert.New(t)
+
+	channels, patterns := interestChannels("plasma:", []string{"program:1234", "news[1]"})
+	assert.Equal([]string{"plasma:program:1234", "plasma:news[1]"}, channels)
+	assert.Equal([]string{"plasma:program:1234:*", `plasma:news\[1\]:*`}, patterns)
+}
@@ -54,7 +54,16 @@ func (m *Mock) Subscribe() error {
 
 	for range t.C {
 		payload := genFakeEventPayload()
+		payload.ReceivedAt = time.Now()
 		m.pubsub.Publish(payload)
 	}
 	return nil
 }
+
+func (m *Mock) Health() error {
+	return nil
+}
+
+func (m *Mock) Reload(config.Config) error {
+	return nil
+}
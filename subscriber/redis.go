@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,7 +13,10 @@ import (
 	"github.com/go-redis/redis"
 	"github.com/openfresh/plasma/config"
 	"github.com/openfresh/plasma/event"
+	"github.com/openfresh/plasma/metrics"
 	"github.com/openfresh/plasma/pubsub"
+	"github.com/openfresh/plasma/trace"
+	"github.com/pkg/errors"
 )
 
 type Redis struct {
@@ -20,24 +24,176 @@ type Redis struct {
 	pubsub      pubsub.PubSuber
 	client      *redis.Client
 	errorLogger *zap.Logger
+	mu          sync.RWMutex
+	health      error
+	// NOTE: channels and ps are changed by Reload
+	channels []string
+	ps       *redis.PubSub
+	// NOTE: interest is nil in the static mode, and subscribed are the event types subscribed by interest.
+	// interestMu serializes the changes of subscribed, so that mu isn't held during the I/O
+	interest   *interest
+	interestMu sync.Mutex
+	subscribed []string
 }
 
-func newRedis(pb pubsub.PubSuber, errorLogger *zap.Logger, config config.Config) (Subscriber, error) {
-	redisConf := config.Subscriber.Redis
+var errNotSubscribed = errors.New("not subscribed to redis yet")
+
+func newRedis(pb pubsub.PubSuber, errorLogger *zap.Logger, c config.Config) (Subscriber, error) {
+	redisConf := c.Subscriber.Redis
 	addr := redisConf.Addr
 	opt := &redis.Options{
 		Addr:     addr,
-		Password: redisConf.Password,
+		Password: redisConf.Password.Value(),
 		DB:       redisConf.DB,
 	}
 
 	client := redis.NewClient(opt)
-	return &Redis{
+	r := &Redis{
 		client:      client,
 		config:      redisConf,
 		pubsub:      pb,
 		errorLogger: errorLogger,
-	}, nil
+		health:      errNotSubscribed,
+		channels:    redisConf.Channels,
+	}
+	if redisConf.Mode == config.RedisModeInterest {
+		r.interest = newInterest()
+	}
+	return r, nil
+}
+
+// Join is called by the client managers. In the interest mode, the channels of the event type are subscribed
+// when the first local client subscribes to it.
+func (r *Redis) Join(eventType string) {
+	if r.interest != nil {
+		r.interest.Join(eventType)
+	}
+}
+
+// Leave unsubscribes from the channels of the event type when the last local client leaves in the interest mode.
+func (r *Redis) Leave(eventType string) {
+	if r.interest != nil {
+		r.interest.Leave(eventType)
+	}
+}
+
+func (r *Redis) watchInterest() {
+	for range r.interest.changed {
+		if err := r.applyInterest(); err != nil {
+			r.errorLogger.Error("failed to change redis subscriptions by interest",
+				zap.Error(err),
+			)
+			time.Sleep(r.config.RetryInterval)
+			r.interest.notify()
+		}
+	}
+}
+
+// applyInterest subscribes to the channels of the event types which have local subscribers,
+// and unsubscribes from the others.
+func (r *Redis) applyInterest() error {
+	next := r.interest.eventTypes()
+
+	r.interestMu.Lock()
+	defer r.interestMu.Unlock()
+	added, removed := diffChannels(r.subscribed, next)
+
+	r.mu.RLock()
+	ps := r.ps
+	r.mu.RUnlock()
+
+	if len(added) != 0 {
+		channels, patterns := interestChannels(r.config.ChannelPrefix, added)
+		if err := ps.Subscribe(channels...); err != nil {
+			return errors.Wrapf(err, "failed to subscribe to %v", channels)
+		}
+		if err := ps.PSubscribe(patterns...); err != nil {
+			return errors.Wrapf(err, "failed to subscribe to %v", patterns)
+		}
+	}
+	if len(removed) != 0 {
+		channels, patterns := interestChannels(r.config.ChannelPrefix, removed)
+		if err := ps.Unsubscribe(channels...); err != nil {
+			return errors.Wrapf(err, "failed to unsubscribe from %v", channels)
+		}
+		if err := ps.PUnsubscribe(patterns...); err != nil {
+			return errors.Wrapf(err, "failed to unsubscribe from %v", patterns)
+		}
+	}
+	r.subscribed = next
+	if len(added) != 0 || len(removed) != 0 {
+		r.errorLogger.Debug("changed redis subscriptions by interest",
+			zap.Strings("added", added),
+			zap.Strings("removed", removed),
+		)
+	}
+	return nil
+}
+
+// Reload subscribes to the added channels and unsubscribes from the removed ones on the current connection,
+// so that the clients aren't dropped.
+func (r *Redis) Reload(config config.Config) error {
+	channels := config.Subscriber.Redis.Channels
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	added, removed := diffChannels(r.channels, channels)
+	if r.ps != nil {
+		if len(added) != 0 {
+			if err := r.ps.Subscribe(added...); err != nil {
+				return errors.Wrapf(err, "failed to subscribe to %v", added)
+			}
+		}
+		if len(removed) != 0 {
+			if err := r.ps.Unsubscribe(removed...); err != nil {
+				return errors.Wrapf(err, "failed to unsubscribe from %v", removed)
+			}
+		}
+	}
+	r.channels = channels
+	if len(added) != 0 || len(removed) != 0 {
+		r.errorLogger.Info("changed redis channels",
+			zap.Strings("added", added),
+			zap.Strings("removed", removed),
+		)
+	}
+	return nil
+}
+
+// diffChannels returns the channels which are only in next and only in prev.
+func diffChannels(prev, next []string) (added, removed []string) {
+	in := func(channels []string, c string) bool {
+		for _, channel := range channels {
+			if channel == c {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range next {
+		if !in(prev, c) {
+			added = append(added, c)
+		}
+	}
+	for _, c := range prev {
+		if !in(next, c) {
+			removed = append(removed, c)
+		}
+	}
+	return added, removed
+}
+
+// Health returns the last error of the subscription. It is cleared when a message is received.
+func (r *Redis) Health() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.health
+}
+
+func (r *Redis) setHealth(err error) {
+	r.mu.Lock()
+	r.health = err
+	r.mu.Unlock()
 }
 
 func (r *Redis) isNetworkError(err error) bool {
@@ -55,6 +211,7 @@ func (r *Redis) receiveMessage(pb *redis.PubSub) (*redis.Message, error) {
 		msgi, err := pb.ReceiveTimeout(r.config.Timeout)
 		if err != nil {
 			if !r.isNetworkError(err) {
+				r.setHealth(err)
 				return nil, err
 			}
 
@@ -68,23 +225,29 @@ func (r *Redis) receiveMessage(pb *redis.PubSub) (*redis.Message, error) {
 			}
 
 			if errNum >= r.config.MaxRetry {
+				r.setHealth(err)
 				return nil, err
 			}
 
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// NOTE: timeout means no messages, so the subscription is healthy if ping succeeds
 				if err := pb.Ping(); err != nil {
 					r.errorLogger.Info("redis ping error",
 						zap.Int("errorCount", errNum),
 						zap.Object("config", r.config),
 						zap.Error(err),
 					)
+					r.setHealth(err)
 				}
+			} else {
+				r.setHealth(err)
 			}
 			time.Sleep(r.config.RetryInterval)
 			continue
 		}
 
 		errNum = 0
+		r.setHealth(nil)
 
 		switch msg := msgi.(type) {
 		case *redis.Subscription:
@@ -101,8 +264,16 @@ func (r *Redis) receiveMessage(pb *redis.PubSub) (*redis.Message, error) {
 }
 
 func (r *Redis) Subscribe() error {
-	ps := r.client.Subscribe(r.config.Channels...)
+	r.mu.Lock()
+	ps := r.client.Subscribe(r.channels...)
+	r.ps = ps
+	r.mu.Unlock()
 	defer ps.Close()
+	if r.interest != nil {
+		// NOTE: clients can subscribe before the subscription starts
+		r.interest.notify()
+		go r.watchInterest()
+	}
 	for {
 		msg, err := r.receiveMessage(ps)
 		if err != nil {
@@ -135,7 +306,17 @@ func (r *Redis) Subscribe() error {
 			)
 			continue
 		}
+		payload.ReceivedAt = time.Now()
+		if publishedAt := payload.Meta.PublishedTime(); !publishedAt.IsZero() {
+			metrics.ObservePublishToIngest(payload.ReceivedAt.Sub(publishedAt))
+		}
+		span := trace.Start("plasma.ingest", trace.FromTraceparent(payload.Meta.Traceparent), trace.KindConsumer)
+		span.SetAttribute("plasma.event_type", payload.Meta.Type)
+		span.SetAttribute("messaging.system", "redis")
+		span.SetAttribute("messaging.source.name", msg.Channel)
+		payload.Meta.Traceparent = span.Traceparent()
 		r.pubsub.Publish(payload)
+		span.End()
 		r.errorLogger.Info("publish plasma event payload",
 			zap.String("payload", msg.Payload),
 			zap.String("channel", msg.Channel),
@@ -62,10 +62,62 @@ func TestRedisReceiveMessage(t *testing.T) {
 	assert.Nil(err)
 	opt := &redis.Options{
 		Addr:     baseRedisConf.Addr,
-		Password: baseRedisConf.Password,
+		Password: baseRedisConf.Password.Value(),
 		DB:       baseRedisConf.DB,
 	}
 	err = redis.NewClient(opt).Publish(baseRedisConf.Channels[0], string(b)).Err()
 	assert.Nil(err)
 
 }
+
+func TestRedisHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	el, err := log.NewLogger(config.Log{
+		Out: "discard",
+	})
+	assert.Nil(err)
+
+	s, err := newRedis(pubsub.NewPubSub(), el, config.Config{
+		Subscriber: config.Subscriber{
+			Redis: config.Redis{
+				// NOTE: nothing listens on this port
+				Addr:          "127.0.0.1:1",
+				Channels:      config.Channels([]string{"plasma_test"}),
+				MaxRetry:      1,
+				Timeout:       100 * time.Millisecond,
+				RetryInterval: 10 * time.Millisecond,
+			},
+		},
+	})
+	assert.Nil(err)
+	r := s.(*Redis)
+
+	assert.Equal(errNotSubscribed, r.Health())
+
+	ps := r.client.Subscribe(r.config.Channels...)
+	defer ps.Close()
+	_, err = r.receiveMessage(ps)
+	assert.Error(err)
+	assert.Equal(err, r.Health())
+}
+
+func TestDiffChannels(t *testing.T) {
+	cases := []struct {
+		prev    []string
+		next    []string
+		added   []string
+		removed []string
+	}{
+		{prev: []string{"a"}, next: []string{"a"}},
+		{prev: []string{"a"}, next: []string{"a", "b"}, added: []string{"b"}},
+		{prev: []string{"a", "b"}, next: []string{"b"}, removed: []string{"a"}},
+		{prev: []string{"a"}, next: []string{"b"}, added: []string{"b"}, removed: []string{"a"}},
+	}
+
+	for _, c := range cases {
+		added, removed := diffChannels(c.prev, c.next)
+		assert.Equal(t, c.added, added)
+		assert.Equal(t, c.removed, removed)
+	}
+}
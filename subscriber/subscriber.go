@@ -12,6 +12,10 @@ import (
 
 type Subscriber interface {
 	Subscribe() error
+	// Health returns an error if the subscriber can't receive events from the backend.
+	Health() error
+	// Reload applies the settings which can be changed without dropping clients.
+	Reload(config conf.Config) error
 }
 
 func New(pb pubsub.PubSuber, errorLogger *zap.Logger, config conf.Config) (Subscriber, error) {
@@ -0,0 +1,238 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/pkg/errors"
+)
+
+const scopeName = "github.com/openfresh/plasma"
+
+// The following types are the OTLP/HTTP JSON encoding of ExportTraceServiceRequest.
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanData `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	// NOTE: int64 is encoded as a string in JSON
+	IntValue *string `json:"intValue,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *Span) data() spanData {
+	d := spanData{
+		TraceID:           s.context.TraceID.String(),
+		SpanID:            s.context.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        s.attributes,
+		Status:            s.status,
+	}
+	if s.parent != (SpanID{}) {
+		d.ParentSpanID = s.parent.String()
+	}
+	return d
+}
+
+// exporter exports spans in batches to the OTLP/HTTP endpoint.
+type exporter struct {
+	endpoint    string
+	client      *http.Client
+	resource    resource
+	spans       chan *Span
+	batchSize   int
+	interval    time.Duration
+	dropped     int64
+	errorLogger *zap.Logger
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// New creates a tracer which exports spans to the OTLP/HTTP endpoint, ex) http://localhost:4318/v1/traces
+func New(config config.Tracing, errorLogger *zap.Logger) (*Tracer, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("tracing endpoint is required")
+	}
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size: %d", config.BatchSize)
+	}
+
+	serviceName := config.ServiceName
+	e := &exporter{
+		endpoint: config.Endpoint,
+		client:   &http.Client{Timeout: config.Timeout},
+		resource: resource{Attributes: []keyValue{
+			{Key: "service.name", Value: anyValue{StringValue: &serviceName}},
+		}},
+		// NOTE: spans are dropped if the exporter can't keep up, so that tracing never blocks delivery
+		spans:       make(chan *Span, config.BatchSize*4),
+		batchSize:   config.BatchSize,
+		interval:    config.Interval,
+		errorLogger: errorLogger,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+
+	return &Tracer{
+		sampleRate: config.SampleRate,
+		exporter:   e,
+		rand:       newRand(),
+	}, nil
+}
+
+// Stop exports the remaining spans.
+func (t *Tracer) Stop() {
+	if t.exporter == nil {
+		return
+	}
+	close(t.exporter.done)
+	<-t.exporter.stopped
+}
+
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.stopped)
+
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			e.errorLogger.Error("failed to export spans",
+				zap.Error(err),
+				zap.String("endpoint", e.endpoint),
+				zap.Int("spans", len(batch)),
+			)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+			if dropped := atomic.SwapInt64(&e.dropped, 0); dropped != 0 {
+				e.errorLogger.Info("dropped spans",
+					zap.Int64("spans", dropped),
+				)
+			}
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+					if len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) export(batch []*Span) error {
+	spans := make([]spanData, len(batch))
+	for i, s := range batch {
+		spans[i] = s.data()
+	}
+
+	b, err := json.Marshal(exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: e.resource,
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal spans")
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to post spans")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/plasma/config"
+	"github.com/openfresh/plasma/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is an in-process OTLP/HTTP collector.
+type collector struct {
+	mu    sync.Mutex
+	spans []spanData
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *collector) Spans() []spanData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]spanData(nil), c.spans...)
+}
+
+func newTestTracer(t *testing.T, endpoint string, sampleRate float64) *Tracer {
+	logger, err := log.NewLogger(config.Log{
+		Out:   "discard",
+		Level: "error",
+	})
+	require.NoError(t, err)
+
+	tracer, err := New(config.Tracing{
+		Endpoint:    endpoint,
+		ServiceName: "plasma-test",
+		SampleRate:  sampleRate,
+		BatchSize:   2,
+		Interval:    time.Hour,
+		Timeout:     time.Second,
+	}, logger)
+	require.NoError(t, err)
+	return tracer
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	tracer := newTestTracer(t, server.URL, 1)
+
+	parent := FromTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ingest := tracer.Start("plasma.ingest", parent, KindConsumer)
+	ingest.SetAttribute("plasma.event_type", "program:1234")
+	fanout := tracer.Start("plasma.fanout", FromTraceparent(ingest.Traceparent()), KindInternal)
+	fanout.SetAttribute("plasma.bytes", 10)
+	fanout.SetError(errors.New("failed"))
+	fanout.End()
+	ingest.End()
+	// the remaining span is exported when the tracer stops
+	root := tracer.Start("plasma.root", SpanContext{}, KindServer)
+	root.End()
+	tracer.Stop()
+
+	spans := c.Spans()
+	require.Len(t, spans, 3)
+
+	assert.Equal("plasma.fanout", spans[0].Name)
+	assert.Equal(parent.TraceID.String(), spans[0].TraceID)
+	assert.Equal(ingest.Context().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal(KindInternal, spans[0].Kind)
+	assert.Equal(statusError, spans[0].Status.Code)
+	assert.Equal("10", *spans[0].Attributes[0].Value.IntValue)
+
+	assert.Equal("plasma.ingest", spans[1].Name)
+	assert.Equal(parent.SpanID.String(), spans[1].ParentSpanID)
+	assert.Equal("program:1234", *spans[1].Attributes[0].Value.StringValue)
+
+	assert.Equal("plasma.root", spans[2].Name)
+	assert.Equal("", spans[2].ParentSpanID)
+	assert.NotEqual(parent.TraceID.String(), spans[2].TraceID)
+}
+
+func TestExportNotSampled(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	tracer := newTestTracer(t, server.URL, 0)
+
+	root := tracer.Start("plasma.root", SpanContext{}, KindServer)
+	assert.True(t, root.Context().IsValid())
+	assert.False(t, root.Context().Sampled)
+	root.End()
+
+	// the sampling decision of the parent is respected
+	sampled := tracer.Start("plasma.child", FromTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"), KindInternal)
+	sampled.End()
+	tracer.Stop()
+
+	spans := c.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "plasma.child", spans[0].Name)
+}
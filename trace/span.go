@@ -0,0 +1,164 @@
+package trace
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type Kind int
+
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+	KindProducer Kind = 4
+	KindConsumer Kind = 5
+)
+
+const statusError = 2
+
+// Span is a unit of work. A span which isn't recording only propagates the parent context.
+type Span struct {
+	recording  bool
+	tracer     *Tracer
+	name       string
+	kind       Kind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	attributes []keyValue
+	status     status
+}
+
+func (s *Span) isRecording() bool {
+	return s != nil && s.recording && s.context.Sampled
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// Traceparent returns the traceparent to propagate the span to children.
+func (s *Span) Traceparent() string {
+	return s.Context().Traceparent()
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.isRecording() {
+		return
+	}
+	var v anyValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		i := strconv.Itoa(value)
+		v.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(value, 10)
+		v.IntValue = &i
+	default:
+		str := fmt.Sprint(value)
+		v.StringValue = &str
+	}
+	s.attributes = append(s.attributes, keyValue{Key: key, Value: v})
+}
+
+func (s *Span) SetError(err error) {
+	if !s.isRecording() || err == nil {
+		return
+	}
+	s.status = status{Code: statusError, Message: err.Error()}
+}
+
+// End finishes the span and exports it if it is sampled.
+func (s *Span) End() {
+	if !s.isRecording() {
+		return
+	}
+	s.end = time.Now()
+	s.tracer.exporter.enqueue(s)
+}
+
+// Tracer creates spans. The zero value creates no spans.
+type Tracer struct {
+	sampleRate float64
+	exporter   *exporter
+	mu         sync.Mutex
+	rand       *rand.Rand
+}
+
+var tracer = &Tracer{}
+
+// SetTracer sets the tracer used by Start.
+func SetTracer(t *Tracer) {
+	tracer = t
+}
+
+// Start starts a span which is a child of the parent. If the parent is invalid, a new trace is started.
+// If tracing is disabled, the span isn't recording and has the parent context.
+func Start(name string, parent SpanContext, kind Kind) *Span {
+	return tracer.Start(name, parent, kind)
+}
+
+func (t *Tracer) Start(name string, parent SpanContext, kind Kind) *Span {
+	if t.exporter == nil {
+		return &Span{context: parent}
+	}
+
+	s := &Span{
+		recording: true,
+		tracer:    t,
+		name:      name,
+		kind:      kind,
+		start:     time.Now(),
+	}
+
+	t.mu.Lock()
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		t.rand.Read(s.context.TraceID[:])
+		s.context.Sampled = t.rand.Float64() < t.sampleRate
+	}
+	t.rand.Read(s.context.SpanID[:])
+	t.mu.Unlock()
+
+	return s
+}
+
+func newRand() *rand.Rand {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+type spanKey struct{}
+
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span in the context. It returns nil if there is no span.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
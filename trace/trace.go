@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the context propagated by the W3C traceparent.
+// https://www.w3.org/TR/trace-context/#traceparent-header
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+const (
+	traceparentVersion = "00"
+	traceparentLength  = 55
+	flagSampled        = "01"
+	flagNotSampled     = "00"
+)
+
+// Traceparent returns the traceparent of the span context. It returns "" if the span context is invalid.
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := flagNotSampled
+	if sc.Sampled {
+		flags = flagSampled
+	}
+	return traceparentVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// FromTraceparent parses the traceparent. It returns the zero span context if the traceparent is invalid.
+func FromTraceparent(traceparent string) SpanContext {
+	var sc SpanContext
+	// NOTE: future versions can append fields, so only the version ff and shorter ones are rejected
+	if len(traceparent) < traceparentLength || traceparent[:2] == "ff" {
+		return sc
+	}
+	if traceparent[:2] == traceparentVersion && len(traceparent) != traceparentLength {
+		return sc
+	}
+	parts := strings.SplitN(traceparent[:traceparentLength], "-", 4)
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}
+	}
+	return sc
+}
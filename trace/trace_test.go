@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromTraceparent(t *testing.T) {
+	cases := []struct {
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true, sampled: true},
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true, sampled: false},
+		// future versions can have additional fields
+		{traceparent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: true, sampled: true},
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: false},
+		{traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: false},
+		{traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", valid: false},
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", valid: false},
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", valid: false},
+		{traceparent: "00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01", valid: false},
+		{traceparent: "", valid: false},
+	}
+
+	for _, c := range cases {
+		sc := FromTraceparent(c.traceparent)
+		assert.Equal(t, c.valid, sc.IsValid(), c.traceparent)
+		assert.Equal(t, c.sampled, sc.Sampled, c.traceparent)
+		if c.valid && c.traceparent[:2] == traceparentVersion {
+			assert.Equal(t, c.traceparent, sc.Traceparent())
+		}
+	}
+}
+
+func TestStartDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	parent := FromTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	span := (&Tracer{}).Start("test", parent, KindInternal)
+	// NOTE: the parent context is propagated as is
+	assert.Equal(parent, span.Context())
+	span.SetAttribute("key", "value")
+	span.End()
+
+	var nilSpan *Span
+	assert.Equal("", nilSpan.Traceparent())
+	nilSpan.SetAttribute("key", "value")
+	nilSpan.End()
+}